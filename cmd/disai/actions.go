@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// Custom ID prefixes of the buttons on answers
+const (
+	componentRegenerate = "regenerate"
+	componentContinue   = "continue"
+	componentStop       = "stop"
+)
+
+// continuePrompt asks the model to extend an answer that was cut off
+const continuePrompt = "Continue your previous answer exactly where it stopped. Do not repeat what you already wrote."
+
+// answerComponents are the buttons below a delivered answer.
+func answerComponents(id string, reasoning bool) []discordgo.MessageComponent {
+	buttons := []discordgo.MessageComponent{
+		discordgo.Button{
+			Label:    "Regenerate",
+			Style:    discordgo.SecondaryButton,
+			Emoji:    &discordgo.ComponentEmoji{Name: "🔄"},
+			CustomID: customID(componentRegenerate, id),
+		},
+		discordgo.Button{
+			Label:    "Continue",
+			Style:    discordgo.SecondaryButton,
+			Emoji:    &discordgo.ComponentEmoji{Name: "⏩"},
+			CustomID: customID(componentContinue, id),
+		},
+	}
+	if reasoning {
+		buttons = append(buttons, discordgo.Button{
+			Label:    "Show thinking",
+			Style:    discordgo.SecondaryButton,
+			Emoji:    &discordgo.ComponentEmoji{Name: "💭"},
+			CustomID: customID(componentThinking, id),
+		})
+	}
+	return []discordgo.MessageComponent{discordgo.ActionsRow{Components: buttons}}
+}
+
+// stopComponents is the button shown while the answer is generated.
+func stopComponents(id string) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Stop",
+					Style:    discordgo.DangerButton,
+					Emoji:    &discordgo.ComponentEmoji{Name: "⏹️"},
+					CustomID: customID(componentStop, id),
+				},
+			},
+		},
+	}
+}
+
+// cancelledEmbed keeps the part of the answer generated before the job was cancelled.
+func cancelledEmbed(cr chatRequest, prog *progress, cancel *cancelError) *discordgo.MessageEmbed {
+	text := prog.Text()
+	if text == "" {
+		text = "Cancelled before the model started answering."
+	}
+	footer := fmt.Sprintf("Cancelled by %s after %.2fs", cancel.user.Username, cancel.at.Sub(prog.start).Seconds())
+	embed := createEmbed(cr.title, TailText(text, embedDescriptionLimit), footer)
+	embed.Timestamp = cancel.at.Format(time.RFC3339)
+	return embed
+}
+
+func (a *App) stopHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, id := parseCustomID(i.MessageComponentData().CustomID)
+	jb, ok := a.jobs.get(id)
+	if !ok {
+		_ = sendInteractionResponse(s, i, createEmbed(embedAuthorError, "This answer is already finished.", ""), discordgo.MessageFlagsEphemeral)
+		return
+	}
+	user := interactionUser(i)
+	if jb.user.ID != user.ID {
+		a.notOwnerResponse(s, i, jb.user)
+		return
+	}
+	jb.cancelBy(user)
+	// The chat replaces the embed itself, only acknowledge the click
+	_ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate})
+}
+
+// regenerateHandler runs the prompt of the answer again with a new seed.
+func (a *App) regenerateHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	ans, ok := a.ownAnswer(s, i)
+	if !ok {
+		return
+	}
+	cr := ans.request
+	cr.id = i.ID
+	cr.command = componentRegenerate
+	cr.history = append([]*ai.Message{}, ans.history...)
+	cr.replaces = ans.messages
+	cr.thread = ""
+	cr.generation.Seed = ptr(rand.IntN(math.MaxInt32))
+	a.rerun(s, i, cr)
+}
+
+// continueHandler asks the model to extend the answer.
+func (a *App) continueHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	ans, ok := a.ownAnswer(s, i)
+	if !ok {
+		return
+	}
+	cr := ans.request
+	cr.id = i.ID
+	cr.command = componentContinue
+	cr.history = append(slices.Clone(ans.history), ans.messages...)
+	cr.input = continuePrompt
+	cr.attachments = nil
+	cr.thread = ""
+	a.rerun(s, i, cr)
+}
+
+// rerun answers a button click with a new message that gets the answer.
+func (a *App) rerun(s *discordgo.Session, i *discordgo.InteractionCreate, cr chatRequest) {
+	if a.limitedInteraction(s, i, cr.command) {
+		return
+	}
+	if err := a.thinkingResponse(s, i); err != nil {
+		return
+	}
+	a.chat(&interactionReplier{s: s, i: i}, cr)
+}
+
+// ownAnswer returns the answer of the button, only its requester may use it.
+func (a *App) ownAnswer(s *discordgo.Session, i *discordgo.InteractionCreate) (*answer, bool) {
+	_, id := parseCustomID(i.MessageComponentData().CustomID)
+	ans, ok := a.answers.Get(id)
+	if !ok {
+		_ = sendInteractionResponse(s, i, createEmbed(embedAuthorError, "This answer is too old, ask again.", ""), discordgo.MessageFlagsEphemeral)
+		return nil, false
+	}
+	if ans.request.user.ID != interactionUser(i).ID {
+		a.notOwnerResponse(s, i, ans.request.user)
+		return nil, false
+	}
+	return ans, true
+}
+
+func (a *App) notOwnerResponse(s *discordgo.Session, i *discordgo.InteractionCreate, owner *discordgo.User) {
+	embed := createEmbed(embedAuthorError, fmt.Sprintf("Only %s can use these buttons.", owner.Mention()), "")
+	_ = sendInteractionResponse(s, i, embed, discordgo.MessageFlagsEphemeral)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// answer is a delivered chat answer, kept for the buttons below it.
+type answer struct {
+	// request is the chat that produced the answer
+	request chatRequest
+	// history is the conversation the model saw before the turn
+	history []*ai.Message
+	// messages are the messages of the turn, including the answer
+	messages  []*ai.Message
+	reasoning string
+	created   time.Time
+}
+
+// answerStore keeps recent answers for the "Show thinking", "Regenerate" and
+// "Continue" buttons. The oldest entries are dropped when it is full.
+type answerStore struct {
+	mu      sync.Mutex
+	limit   int
+	ttl     time.Duration
+	order   []string
+	entries map[string]*answer
+}
+
+func newAnswerStore(limit int, ttl time.Duration) *answerStore {
+	return &answerStore{
+		limit:   limit,
+		ttl:     ttl,
+		entries: make(map[string]*answer),
+	}
+}
+
+// Put stores the answer of the response with the given ID.
+func (r *answerStore) Put(id string, a *answer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.entries[id]; !ok {
+		r.order = append(r.order, id)
+	}
+	a.created = time.Now()
+	r.entries[id] = a
+	for len(r.order) > r.limit {
+		delete(r.entries, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+// Get returns the answer of the response with the given ID.
+func (r *answerStore) Get(id string) (*answer, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.entries[id]
+	if !ok || time.Since(e.created) > r.ttl {
+		return nil, false
+	}
+	return e, true
+}
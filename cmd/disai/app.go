@@ -1,10 +1,20 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
+	"sync/atomic"
+	"time"
 
+	"github.com/FlameInTheDark/disai/internal/conversation"
 	"github.com/FlameInTheDark/disai/internal/mcp"
+	"github.com/FlameInTheDark/disai/internal/metrics"
 	"github.com/FlameInTheDark/disai/internal/model"
+	"github.com/FlameInTheDark/disai/internal/ratelimit"
+	"github.com/FlameInTheDark/disai/internal/settings"
+	"github.com/FlameInTheDark/disai/internal/storage"
+	"github.com/FlameInTheDark/disai/internal/tracing"
 	"github.com/bwmarrin/discordgo"
 
 	"github.com/FlameInTheDark/disai/internal/config"
@@ -13,27 +23,95 @@ import (
 type App struct {
 	s *discordgo.Session
 
-	model *model.Model
+	model    *model.Model
+	pool     *model.Pool
+	store    storage.Store
+	memory   *conversation.Store
+	answers  *answerStore
+	settings *settings.Store
+	jobs     *jobRegistry
+	limiter  *ratelimit.Limiter
+	// stopBackground stops the health checks and the request log pruning
+	stopBackground context.CancelFunc
+	// stopTracing flushes the spans that were not exported yet
+	stopTracing func(context.Context) error
 
-	handlers map[string]func(s *discordgo.Session, m *discordgo.InteractionCreate)
+	// live holds the config sections that are swapped on reload, use conf to read it
+	live atomic.Pointer[liveConfig]
+	// overrides are the generation options users may set with /chat arguments
+	overrides []string
+
+	// devGuild registers the commands in a single guild for testing
+	devGuild string
+
+	router *router
 }
 
-func NewApp(cfg config.Config) *App {
-	mcpClient := mcp.NewClient(cfg.MCPServers)
-	modelClient := model.NewModel(cfg.Model, cfg.OllamaServers, mcpClient, cfg.Templates.System, cfg.Templates.User, cfg.ToolNames)
+func NewApp(cfg config.Config) (*App, error) {
+	// Tracing goes first, so Genkit picks up the tracer provider
+	stopTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		return nil, err
+	}
+	mcpClient, err := mcp.NewClient(cfg.MCPServers)
+	if err != nil {
+		return nil, err
+	}
+	pool := model.NewPool(cfg.OllamaServers, cfg.Balancing, cfg.Queue)
+	modelClient, err := model.NewModel(cfg, pool, mcpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := storage.Open(cfg.Storage.Path)
+	if err != nil {
+		return nil, err
+	}
 
 	s, err := discordgo.New("Bot " + cfg.Token)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("unable to create discord session: %w", err)
+	}
+	s.Identify.Intents = discordgo.IntentsAllWithoutPrivileged
+	// Message content is needed to answer replies that do not mention the bot and
+	// messages in threads. The intent is privileged, so it is only requested when used.
+	if cfg.Mentions.Any() {
+		s.Identify.Intents |= discordgo.IntentMessageContent
+		slog.Info("Requesting the message content intent, enable \"Message Content Intent\" in the developer portal")
+	} else {
+		slog.Info("Mentions are disabled, the message content intent is not requested")
 	}
 
-	return &App{
-		s:     s,
-		model: modelClient,
+	a := &App{
+		s:      s,
+		model:  modelClient,
+		pool:   pool,
+		store:  store,
+		memory: conversation.NewStore(cfg.Memory, store),
+
+		answers:  newAnswerStore(1000, 24*time.Hour),
+		settings: settings.New(store),
+		jobs:     newJobRegistry(),
+		limiter:  ratelimit.New(store),
+
+		stopTracing: stopTracing,
+
+		overrides: enabledOverrides(cfg.ChatOverrides),
+		devGuild:  cfg.Commands.DevGuild,
 	}
+	a.live.Store(newLiveConfig(cfg))
+	a.registerMetrics()
+	return a, nil
 }
 
 func (a *App) Run() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	a.stopBackground = cancel
+	go a.pool.Run(ctx)
+	go a.pruneRequests(ctx)
+	if addr := a.conf().cfg.Metrics.Listen; addr != "" {
+		go metrics.Serve(ctx, addr)
+	}
 	err := a.s.Open()
 	if err != nil {
 		return err
@@ -45,3 +123,62 @@ func (a *App) Run() error {
 	slog.Info("Logged in", slog.String("username", user.Username), slog.String("discriminator", user.Discriminator))
 	return nil
 }
+
+// Shutdown stops accepting interactions and waits for running chats until the
+// shutdown timeout. Chats that are still running get a restart notice.
+func (a *App) Shutdown() {
+	a.jobs.close()
+	timeout := a.conf().cfg.Shutdown.Timeout
+	slog.Info("Shutting down", slog.Int("chats", len(a.jobs.remaining())), slog.Duration("timeout", timeout))
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if !a.jobs.wait(ctx) {
+		slog.Warn("Cancelling unfinished chats", slog.Int("chats", a.jobs.cancelAll(errShuttingDown)))
+		// Cancelled chats replace their embeds with the notice themselves
+		graceCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if !a.jobs.wait(graceCtx) {
+			for _, jb := range a.jobs.remaining() {
+				_ = jb.r.Edit(restartingEmbed(), nil, nil)
+			}
+		}
+	}
+
+	if a.stopBackground != nil {
+		a.stopBackground()
+	}
+	if err := a.model.Close(); err != nil {
+		slog.Warn("Unable to disconnect MCP servers", slog.String("error", err.Error()))
+	}
+	if err := a.s.Close(); err != nil {
+		slog.Warn("Unable to close the Discord session", slog.String("error", err.Error()))
+	}
+	if err := a.store.Close(); err != nil {
+		slog.Warn("Unable to close the storage", slog.String("error", err.Error()))
+	}
+	tracingCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := a.stopTracing(tracingCtx); err != nil {
+		slog.Warn("Unable to flush traces", slog.String("error", err.Error()))
+	}
+	slog.Info("Stopped")
+}
+
+// pruneRequests removes old entries of the request log once a day.
+func (a *App) pruneRequests(ctx context.Context) {
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+	for {
+		if retention := a.conf().cfg.Storage.RequestRetention; retention > 0 {
+			if err := a.store.PruneRequests(time.Now().Add(-retention)); err != nil {
+				slog.Warn("Unable to prune the request log", slog.String("error", err.Error()))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/FlameInTheDark/disai/internal/model"
+)
+
+// defaultImagePrompt is used when a user sends images without any text.
+const defaultImagePrompt = "Describe this image."
+
+var errNotImage = errors.New("only image attachments are supported")
+
+// imageAttachments keeps the image attachments of a message. Other files are ignored.
+func imageAttachments(attachments []*discordgo.MessageAttachment) []*discordgo.MessageAttachment {
+	var images []*discordgo.MessageAttachment
+	for _, att := range attachments {
+		if strings.HasPrefix(att.ContentType, "image/") {
+			images = append(images, att)
+		}
+	}
+	return images
+}
+
+// downloadImages fetches image attachments, rejecting files that are not images or too large.
+func (a *App) downloadImages(ctx context.Context, attachments []*discordgo.MessageAttachment) ([]model.Image, error) {
+	limits := a.conf().images
+	if limits.MaxCount > 0 && len(attachments) > limits.MaxCount {
+		return nil, fmt.Errorf("too many images, the limit is %d", limits.MaxCount)
+	}
+	var images []model.Image
+	for _, att := range attachments {
+		if !strings.HasPrefix(att.ContentType, "image/") {
+			return nil, errNotImage
+		}
+		if limits.MaxSize > 0 && int64(att.Size) > limits.MaxSize {
+			return nil, fmt.Errorf("image %s is too large, the limit is %d MB", att.Filename, limits.MaxSize/1024/1024)
+		}
+		data, err := download(ctx, att.URL, limits.MaxSize)
+		if err != nil {
+			return nil, fmt.Errorf("unable to download %s: %w", att.Filename, err)
+		}
+		images = append(images, model.Image{ContentType: att.ContentType, Data: data})
+	}
+	return images, nil
+}
+
+func download(ctx context.Context, url string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if limit <= 0 {
+		return io.ReadAll(resp.Body)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, errors.New("file is too large")
+	}
+	return data, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const embedAuthorJobs = "Running jobs"
+
+// cancelHandler cancels one or all running jobs of the user.
+func (a *App) cancelHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	user := interactionUser(i)
+	jobs := a.jobs.byUser(user.ID)
+	if opt, ok := commandOptions(i)["job"]; ok {
+		jobs = pickJob(jobs, opt.StringValue())
+	}
+	if len(jobs) == 0 {
+		_ = sendInteractionResponse(s, i, createEmbed(embedAuthorJobs, "You have no running jobs.", ""), discordgo.MessageFlagsEphemeral)
+		return
+	}
+	for _, jb := range jobs {
+		jb.cancelBy(user)
+	}
+	_ = sendInteractionResponse(s, i, createEmbed(embedAuthorJobs, fmt.Sprintf("Cancelled %d job(s).", len(jobs)), ""), discordgo.MessageFlagsEphemeral)
+}
+
+// jobsHandler lists all running jobs and cancels one of them, for admins only.
+func (a *App) jobsHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	user := interactionUser(i)
+	if !a.conf().access.Admin(user.ID) {
+		_ = a.deniedResponse(s, i)
+		return
+	}
+	if opt, ok := commandOptions(i)["cancel"]; ok {
+		jobs := pickJob(a.jobs.remaining(), opt.StringValue())
+		if len(jobs) == 0 {
+			_ = sendInteractionResponse(s, i, createEmbed(embedAuthorError, "The job is already finished.", ""), discordgo.MessageFlagsEphemeral)
+			return
+		}
+		jobs[0].cancelBy(user)
+		_ = sendInteractionResponse(s, i, createEmbed(embedAuthorJobs, fmt.Sprintf("Cancelled the job of %s.", jobs[0].user.Mention()), ""), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	jobs := a.jobs.remaining()
+	if len(jobs) == 0 {
+		_ = sendInteractionResponse(s, i, createEmbed(embedAuthorJobs, "Nothing is running.", ""), discordgo.MessageFlagsEphemeral)
+		return
+	}
+	lines := make([]string, 0, len(jobs))
+	for _, jb := range jobs {
+		lines = append(lines, fmt.Sprintf("`%s` %s in <#%s>, %s\n> %s", jb.id, jb.user.Mention(), jb.channelID, jobAge(jb), CropText(jb.input, 100)))
+	}
+	footer := fmt.Sprintf("%d running, %d queued", len(jobs), a.pool.QueueLength())
+	_ = sendInteractionResponse(s, i, createEmbed(embedAuthorJobs, CropText(strings.Join(lines, "\n"), embedDescriptionLimit), footer), discordgo.MessageFlagsEphemeral)
+}
+
+// cancelAutocomplete suggests the running jobs of the user.
+func (a *App) cancelAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	a.jobChoices(s, i, a.jobs.byUser(interactionUser(i).ID))
+}
+
+// jobsAutocomplete suggests all running jobs to admins.
+func (a *App) jobsAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var jobs []*job
+	if a.conf().access.Admin(interactionUser(i).ID) {
+		jobs = a.jobs.remaining()
+	}
+	a.jobChoices(s, i, jobs)
+}
+
+func (a *App) jobChoices(s *discordgo.Session, i *discordgo.InteractionCreate, jobs []*job) {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(jobs))
+	for _, jb := range jobs {
+		label := fmt.Sprintf("%s (%s, %s)", jb.input, jb.user.Username, jobAge(jb))
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: CropText(label, 100), Value: jb.id})
+		if len(choices) == 25 {
+			break
+		}
+	}
+	_ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+}
+
+// pickJob returns the job with the given ID from the list.
+func pickJob(jobs []*job, id string) []*job {
+	for _, jb := range jobs {
+		if jb.id == id {
+			return []*job{jb}
+		}
+	}
+	return nil
+}
+
+func jobAge(jb *job) string {
+	return time.Since(jb.started).Round(time.Second).String()
+}
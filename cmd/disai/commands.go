@@ -1,52 +1,251 @@
 package main
 
 import (
+	"fmt"
 	"log/slog"
 
 	"github.com/bwmarrin/discordgo"
 )
 
-func (a *App) createCommands() {
-	commands := []*discordgo.ApplicationCommand{
+// handlerFunc handles an interaction.
+type handlerFunc func(s *discordgo.Session, i *discordgo.InteractionCreate)
+
+// command is a slash command together with the handlers serving it.
+type command struct {
+	def          *discordgo.ApplicationCommand
+	handler      handlerFunc
+	autocomplete handlerFunc
+}
+
+// commands declares every slash command next to its handlers.
+func (a *App) commands() []command {
+	return []command{
+		{
+			def: &discordgo.ApplicationCommand{
+				Name:        "chat",
+				Description: "Ask AI to do something",
+				Options: append([]*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "message",
+						Description: "message for AI",
+						Required:    true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "thread",
+						Description: "continue the conversation in a new thread",
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "public", Value: threadPublic},
+							{Name: "private", Value: threadPrivate},
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionAttachment,
+						Name:        "image",
+						Description: "image for vision models",
+					},
+				}, a.overrideOptions()...),
+				IntegrationTypes: &everyIntegration,
+				Contexts:         &everyContext,
+			},
+			handler: a.chatHandler,
+		},
+		{
+			def: &discordgo.ApplicationCommand{
+				Name:        "model",
+				Description: "Show or pick the model profile",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "profile",
+						Description:  "profile to use",
+						Autocomplete: true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "scope",
+						Description: "who the choice applies to",
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "only me", Value: scopeUser},
+							{Name: "this server", Value: scopeGuild},
+						},
+					},
+				},
+				IntegrationTypes: &everyIntegration,
+				Contexts:         &everyContext,
+			},
+			handler:      a.modelHandler,
+			autocomplete: a.modelAutocomplete,
+		},
 		{
-			Name:        "chat",
-			Description: "Ask AI to do something",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "message",
-					Description: "message for AI",
-					Required:    true,
+			def: &discordgo.ApplicationCommand{
+				Name:             "reset",
+				Description:      "Clear the conversation history in this channel",
+				IntegrationTypes: &everyIntegration,
+				Contexts:         &everyContext,
+			},
+			handler: a.resetHandler,
+		},
+		{
+			def: &discordgo.ApplicationCommand{
+				Name:        "cancel",
+				Description: "Cancel your running answers",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "job",
+						Description:  "answer to cancel, all of them when empty",
+						Autocomplete: true,
+					},
 				},
+				IntegrationTypes: &everyIntegration,
+				Contexts:         &everyContext,
 			},
-			IntegrationTypes: &[]discordgo.ApplicationIntegrationType{
-				discordgo.ApplicationIntegrationGuildInstall,
-				discordgo.ApplicationIntegrationUserInstall,
+			handler:      a.cancelHandler,
+			autocomplete: a.cancelAutocomplete,
+		},
+		{
+			def: &discordgo.ApplicationCommand{
+				Name:        "jobs",
+				Description: "List and cancel running answers of all users (admins only)",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "cancel",
+						Description:  "answer to cancel",
+						Autocomplete: true,
+					},
+				},
+				IntegrationTypes: &everyIntegration,
+				Contexts:         &everyContext,
 			},
-			Contexts: &[]discordgo.InteractionContextType{
-				discordgo.InteractionContextGuild,
-				discordgo.InteractionContextBotDM,
-				discordgo.InteractionContextPrivateChannel,
+			handler:      a.jobsHandler,
+			autocomplete: a.jobsAutocomplete,
+		},
+		{
+			def: &discordgo.ApplicationCommand{
+				Name:        "usage",
+				Description: "Show your requests and tokens",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "period",
+						Description: "days to sum up, 7 days when empty",
+						Choices:     usagePeriods,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "leaderboard",
+						Description: "top users, servers or models (admins only)",
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "users", Value: leaderboardUsers},
+							{Name: "servers", Value: leaderboardGuilds},
+							{Name: "models", Value: leaderboardModels},
+						},
+					},
+				},
+				IntegrationTypes: &everyIntegration,
+				Contexts:         &everyContext,
 			},
+			handler: a.usageHandler,
 		},
 	}
+}
 
-	for _, command := range commands {
-		_, err := a.s.ApplicationCommandCreate(a.s.State.User.ID, "", command)
+// Commands are available in guilds, DMs with the bot and other DMs when installed by a user
+var (
+	everyIntegration = []discordgo.ApplicationIntegrationType{
+		discordgo.ApplicationIntegrationGuildInstall,
+		discordgo.ApplicationIntegrationUserInstall,
+	}
+	everyContext = []discordgo.InteractionContextType{
+		discordgo.InteractionContextGuild,
+		discordgo.InteractionContextBotDM,
+		discordgo.InteractionContextPrivateChannel,
+	}
+)
+
+// syncCommands replaces the registered commands with the declared ones, so renamed
+// and removed commands disappear. With a dev guild the commands are registered in
+// that guild only, where changes show up instantly.
+func (a *App) syncCommands() error {
+	guildID := a.devGuild
+	var defs []*discordgo.ApplicationCommand
+	for _, c := range a.commands() {
+		def := c.def
+		if guildID != "" {
+			// Install types and contexts are only allowed for global commands
+			guildDef := *def
+			guildDef.IntegrationTypes = nil
+			guildDef.Contexts = nil
+			def = &guildDef
+		}
+		defs = append(defs, def)
+	}
+	appID := a.s.State.User.ID
+	registered, err := a.s.ApplicationCommandBulkOverwrite(appID, guildID, defs)
+	if err != nil {
+		return fmt.Errorf("unable to register commands: %w", err)
+	}
+	slog.Info("Commands registered", slog.Int("count", len(registered)), slog.String("guild", guildID))
+
+	// Commands of the previous dev guild would stay there next to the new ones
+	if prev := a.settings.DevGuild(appID); prev != "" && prev != guildID {
+		if _, err := a.s.ApplicationCommandBulkOverwrite(appID, prev, []*discordgo.ApplicationCommand{}); err != nil {
+			slog.Warn("Unable to remove the commands of the previous dev guild", slog.String("guild", prev), slog.String("error", err.Error()))
+		} else {
+			slog.Info("Commands of the previous dev guild removed", slog.String("guild", prev))
+		}
+	}
+	if err := a.settings.SetDevGuild(appID, guildID); err != nil {
+		slog.Warn("Unable to store the dev guild", slog.String("error", err.Error()))
+	}
+
+	if guildID != "" {
+		// Global commands are kept, they may be in use with the same token elsewhere
+		global, err := a.s.ApplicationCommands(appID, "")
 		if err != nil {
-			slog.Error("Unable to create command: ", slog.String("command", command.Name))
+			return fmt.Errorf("unable to list global commands: %w", err)
+		}
+		if len(global) > 0 {
+			slog.Warn("Global commands are registered too and show up twice in the dev guild, use a separate application for development",
+				slog.Int("count", len(global)))
 		}
 	}
+	return nil
 }
 
 func (a *App) registerHandlers() {
-	a.handlers = map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate){
-		"chat": a.chatHandler,
+	a.router = newRouter()
+	for _, c := range a.commands() {
+		a.router.commands[c.def.Name] = c.handler
+		if c.autocomplete != nil {
+			a.router.autocomplete[c.def.Name] = c.autocomplete
+		}
 	}
+	a.router.components[componentThinking] = a.thinkingHandler
+	a.router.components[componentRegenerate] = a.regenerateHandler
+	a.router.components[componentContinue] = a.continueHandler
+	a.router.components[componentStop] = a.stopHandler
 
-	a.s.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-		if h, ok := a.handlers[i.ApplicationCommandData().Name]; ok {
-			h(s, i)
-		}
+	a.s.AddHandler(a.handleInteraction)
+	a.s.AddHandler(func(s *discordgo.Session, m *discordgo.MessageCreate) {
+		defer recoverEvent("message create")
+		a.messageHandler(s, m)
 	})
 }
+
+// guard wraps a handler with the access checker and rejects denied users.
+func (a *App) guard(h handlerFunc) handlerFunc {
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		subject := interactionSubject(i)
+		if !a.conf().access.Allowed(subject) {
+			a.outcome(i.ID, interactionName(i), outcomeDenied)
+			slog.Info("Access denied", slog.String("user", subject.UserID), slog.String("guild", subject.GuildID), slog.String("channel", subject.ChannelID))
+			a.deniedResponse(s, i)
+			return
+		}
+		h(s, i)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/FlameInTheDark/disai/internal/config"
+)
+
+// chatOverride is a generation option that can be set with a /chat argument.
+type chatOverride struct {
+	option *discordgo.ApplicationCommandOption
+	apply  func(g *config.Generation, opt *discordgo.ApplicationCommandInteractionDataOption)
+}
+
+func ptr[T any](v T) *T { return &v }
+
+// chatOverrides are all options the "chatOverrides" config may enable, keyed by argument name.
+// The names match config.ChatOverrideNames.
+var chatOverrides = map[string]chatOverride{
+	"temperature": {
+		option: &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionNumber,
+			Name:        "temperature",
+			Description: "randomness of the answer",
+			MinValue:    ptr(0.0),
+			MaxValue:    2,
+		},
+		apply: func(g *config.Generation, opt *discordgo.ApplicationCommandInteractionDataOption) {
+			g.Temperature = ptr(opt.FloatValue())
+		},
+	},
+	"top_p": {
+		option: &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionNumber,
+			Name:        "top_p",
+			Description: "nucleus sampling threshold",
+			MinValue:    ptr(0.0),
+			MaxValue:    1,
+		},
+		apply: func(g *config.Generation, opt *discordgo.ApplicationCommandInteractionDataOption) {
+			g.TopP = ptr(opt.FloatValue())
+		},
+	},
+	"top_k": {
+		option: &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionInteger,
+			Name:        "top_k",
+			Description: "number of candidate tokens",
+			MinValue:    ptr(1.0),
+			MaxValue:    200,
+		},
+		apply: func(g *config.Generation, opt *discordgo.ApplicationCommandInteractionDataOption) {
+			g.TopK = ptr(int(opt.IntValue()))
+		},
+	},
+	"num_predict": {
+		option: &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionInteger,
+			Name:        "num_predict",
+			Description: "maximum number of generated tokens",
+			MinValue:    ptr(1.0),
+			MaxValue:    8192,
+		},
+		apply: func(g *config.Generation, opt *discordgo.ApplicationCommandInteractionDataOption) {
+			g.NumPredict = ptr(int(opt.IntValue()))
+		},
+	},
+	"repeat_penalty": {
+		option: &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionNumber,
+			Name:        "repeat_penalty",
+			Description: "penalty for repeated tokens",
+			MinValue:    ptr(0.0),
+			MaxValue:    2,
+		},
+		apply: func(g *config.Generation, opt *discordgo.ApplicationCommandInteractionDataOption) {
+			g.RepeatPenalty = ptr(opt.FloatValue())
+		},
+	},
+	"seed": {
+		option: &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionInteger,
+			Name:        "seed",
+			Description: "seed for reproducible answers",
+		},
+		apply: func(g *config.Generation, opt *discordgo.ApplicationCommandInteractionDataOption) {
+			g.Seed = ptr(int(opt.IntValue()))
+		},
+	},
+}
+
+// enabledOverrides filters the configured override names. The config validation rejects
+// unknown names, they are logged and skipped in case the lists ever drift apart.
+func enabledOverrides(names []string) []string {
+	var out []string
+	for _, name := range names {
+		if _, ok := chatOverrides[name]; !ok {
+			slog.Warn("Unknown chat override", slog.String("name", name))
+			continue
+		}
+		out = append(out, name)
+	}
+	return out
+}
+
+// overrideOptions returns the /chat arguments of the enabled overrides.
+func (a *App) overrideOptions() []*discordgo.ApplicationCommandOption {
+	options := make([]*discordgo.ApplicationCommandOption, 0, len(a.overrides))
+	for _, name := range a.overrides {
+		options = append(options, chatOverrides[name].option)
+	}
+	return options
+}
+
+// generationOverrides reads the enabled overrides from the command arguments.
+func (a *App) generationOverrides(options map[string]*discordgo.ApplicationCommandInteractionDataOption) config.Generation {
+	var g config.Generation
+	for _, name := range a.overrides {
+		if opt, ok := options[name]; ok {
+			chatOverrides[name].apply(&g, opt)
+		}
+	}
+	return g
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/FlameInTheDark/disai/internal/config"
+)
+
+func TestChatOverridesMatchConfig(t *testing.T) {
+	if len(chatOverrides) != len(config.ChatOverrideNames) {
+		t.Errorf("%d overrides, the config allows %d", len(chatOverrides), len(config.ChatOverrideNames))
+	}
+	for _, name := range config.ChatOverrideNames {
+		o, ok := chatOverrides[name]
+		if !ok {
+			t.Errorf("no /chat argument for %q", name)
+			continue
+		}
+		if o.option.Name != name {
+			t.Errorf("override %q has the argument name %q", name, o.option.Name)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/url"
@@ -10,11 +11,33 @@ import (
 	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/firebase/genkit/go/ai"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/FlameInTheDark/disai/internal/config"
+	"github.com/FlameInTheDark/disai/internal/model"
+	"github.com/FlameInTheDark/disai/internal/storage"
+	"github.com/FlameInTheDark/disai/internal/tracing"
+)
+
+const (
+	// embedDescriptionLimit is the Discord limit of the embed description length
+	embedDescriptionLimit = 4096
+	// maxAnswerPages is the number of pages sent as messages, longer answers are attached as a file
+	maxAnswerPages = 4
 )
 
 const (
-	embedAuthorThinking = "Thinking..."
-	embedAuthorError    = "Error"
+	embedAuthorThinking   = "Thinking..."
+	embedAuthorError      = "Error"
+	embedAuthorRestarting = "Restarting"
+	embedAuthorReset      = "Conversation reset"
+	embedAuthorReasoning  = "💭 Reasoning"
+)
+
+// Custom ID prefixes of message components
+const (
+	componentThinking = "thinking"
 )
 
 var emojiRegex = regexp.MustCompile(`^\p{So}`)
@@ -53,15 +76,69 @@ func sendInteractionResponse(s *discordgo.Session, i *discordgo.InteractionCreat
 	return nil
 }
 
-// sendInteractionResponseEdit updates a previously sent response.
-func sendInteractionResponseEdit(s *discordgo.Session, i *discordgo.InteractionCreate, embed *discordgo.MessageEmbed) error {
-	respEdit := &discordgo.WebhookEdit{
-		Embeds: &[]*discordgo.MessageEmbed{embed},
+// sendAnswer replaces the response with the answer. Long answers continue in
+// follow-up messages, very long ones are attached as a markdown file.
+func sendAnswer(r replier, title, answer, footer string, components []discordgo.MessageComponent) error {
+	pages := SplitMessage(answer, embedDescriptionLimit)
+	if len(pages) > maxAnswerPages {
+		preview := SplitMessage(answer, embedDescriptionLimit-100)[0]
+		embed := createEmbed(title, preview+"\n\n📎 The full answer is attached as a file.", footer)
+		return r.Edit(embed, components, []*discordgo.File{{
+			Name:        "answer.md",
+			ContentType: "text/markdown",
+			Reader:      strings.NewReader(answer),
+		}})
+	}
+
+	if len(pages) > 1 {
+		footer = fmt.Sprintf("%s • Page 1/%d", footer, len(pages))
+	}
+	if err := r.Edit(createEmbed(title, pages[0], footer), components, nil); err != nil {
+		return err
+	}
+	for n, page := range pages[1:] {
+		if err := r.Followup(createEmbed(fmt.Sprintf("Page %d/%d", n+2, len(pages)), page, "")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendEphemeralPages responds with text visible only to the user, split into
+// pages like answers are.
+func sendEphemeralPages(s *discordgo.Session, i *discordgo.InteractionCreate, title, text string) error {
+	pages := SplitMessage(text, embedDescriptionLimit)
+	data := &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral}
+	if len(pages) > maxAnswerPages {
+		data.Embeds = []*discordgo.MessageEmbed{createEmbed(title, "📎 The full text is attached as a file.", "")}
+		data.Files = []*discordgo.File{{
+			Name:        "reasoning.md",
+			ContentType: "text/markdown",
+			Reader:      strings.NewReader(text),
+		}}
+		pages = nil
+	} else {
+		data.Embeds = []*discordgo.MessageEmbed{createEmbed(title, pages[0], "")}
+		pages = pages[1:]
 	}
-	if _, err := s.InteractionResponseEdit(i.Interaction, respEdit); err != nil {
+	resp := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	}
+	if err := s.InteractionRespond(i.Interaction, resp); err != nil {
 		slog.Error("Unable to send response", slog.String("error", err.Error()))
 		return err
 	}
+	for _, page := range pages {
+		params := &discordgo.WebhookParams{
+			Embeds: []*discordgo.MessageEmbed{createEmbed(title, page, "")},
+			Flags:  discordgo.MessageFlagsEphemeral,
+		}
+		if _, err := s.FollowupMessageCreate(i.Interaction, true, params); err != nil {
+			slog.Error("Unable to send follow-up", slog.String("error", err.Error()))
+			return err
+		}
+	}
 	return nil
 }
 
@@ -72,95 +149,279 @@ func (a *App) chatHandler(s *discordgo.Session, i *discordgo.InteractionCreate)
 		a.errorResponse(s, i, "No message provided")
 		return
 	}
-	userInput := strings.TrimSpace(i.ApplicationCommandData().Options[0].StringValue())
+	options := commandOptions(i)
+	userInput := ""
+	if opt, ok := options["message"]; ok {
+		userInput = strings.TrimSpace(opt.StringValue())
+	}
 	if userInput == "" {
 		slog.Warn("No message provided")
 		a.errorResponse(s, i, "No message provided")
 		return
 	}
 
+	if a.limitedInteraction(s, i, commandChat) {
+		return
+	}
+
 	// Send “Thinking…” response
 	if err := a.thinkingResponse(s, i); err != nil {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
-	defer cancel()
-	start := time.Now()
-
-	escapedInput := url.QueryEscape(strings.ReplaceAll(userInput, "\t", "    "))
-
-	// Status history to track all actions
-	var statusHistory []string
-
-	// Status callback to update Discord embed with accumulated history
-	statusCallback := func(status string) {
-		// Add new status to the history
-		statusHistory = append(statusHistory, status)
-
-		// Create a display history
-		var displayHistory []string
-		for i, s := range statusHistory {
-			if i < len(statusHistory)-1 {
-				// Previous status, mark as completed
-				displayHistory = append(displayHistory, emojiRegex.ReplaceAllString(s, "✅"))
-			} else {
-				// Current status, display as is
-				displayHistory = append(displayHistory, s)
+	cr := chatRequest{
+		id:         i.ID,
+		command:    commandChat,
+		user:       interactionUser(i),
+		guildID:    i.GuildID,
+		channelID:  i.ChannelID,
+		input:      userInput,
+		generation: a.generationOverrides(options),
+	}
+	if opt, ok := options["thread"]; ok {
+		cr.thread = opt.StringValue()
+	}
+	if opt, ok := options["image"]; ok {
+		if data := i.ApplicationCommandData().Resolved; data != nil {
+			if att, ok := data.Attachments[opt.Value.(string)]; ok {
+				cr.attachments = append(cr.attachments, att)
 			}
 		}
+	}
+	a.chat(&interactionReplier{s: s, i: i}, cr)
+}
+
+// chatRequest is a chat started by a slash command or a message.
+type chatRequest struct {
+	// id identifies the answer in message components
+	id string
+	// command is what started the request, e.g. chat or mention, for the metrics
+	command   string
+	user      *discordgo.User
+	guildID   string
+	channelID string
+	input     string
+	// thread starts a public or private thread from the answer when set
+	thread      string
+	attachments []*discordgo.MessageAttachment
+	// history replaces the channel memory when set, e.g. with a reply chain
+	history []*ai.Message
+	// generation overrides the generation options of the profile
+	generation config.Generation
+	// profile is picked from the user and guild settings when empty
+	profile string
+	// title of the answer, "Chat: <input>" when empty
+	title string
+	// replaces are the messages of an earlier answer that the new turn takes the place of
+	// in the channel memory, if that answer is still the last turn there
+	replaces []*ai.Message
+}
+
+// chat runs the request through the model and delivers progress and the answer through the replier.
+func (a *App) chat(r replier, cr chatRequest) {
+	ctx, cancelJob := context.WithCancelCause(context.Background())
+	defer cancelJob(nil)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	jb := &job{
+		id:        cr.id,
+		user:      cr.user,
+		guildID:   cr.guildID,
+		channelID: cr.channelID,
+		input:     cr.input,
+		r:         r,
+		started:   time.Now(),
+		cancel:    cancelJob,
+	}
+	if !a.jobs.start(jb) {
+		_ = r.Edit(restartingEmbed(), nil, nil)
+		return
+	}
+	defer a.jobs.finish(cr.id)
+
+	escapedInput := url.QueryEscape(strings.ReplaceAll(cr.input, "\t", "    "))
 
-		elapsed := time.Since(start).Seconds()
-		footer := fmt.Sprintf("Elapsed: %.1fs", elapsed)
+	history := cr.history
+	if history == nil {
+		history = a.memory.History(cr.channelID)
+	}
+	if cr.profile == "" {
+		cr.profile = a.profileFor(cr.user.ID, cr.guildID)
+	}
+	if cr.title == "" {
+		cr.title = fmt.Sprintf("Chat: %s", CropText(cr.input, 240))
+	}
+	ctx, span := tracing.Start(ctx, "discord."+cr.command,
+		attribute.String("discord.user", cr.user.ID),
+		attribute.String("discord.guild", cr.guildID),
+		attribute.String("discord.channel", cr.channelID),
+		attribute.String("profile", cr.profile),
+	)
+	defer span.End()
 
-		// Create description with all status history
-		description := strings.Join(displayHistory, "\n")
+	// Progress keeps the status history and streamed text in the embed
+	streaming := a.conf().streaming
+	prog := newProgress(r, cr.input, streaming.EditInterval, stopComponents(cr.id))
+	req := model.Request{
+		Profile:    cr.profile,
+		Generation: cr.generation,
+		User:       cr.user.ID,
+		Message:    escapedInput,
+		Args: map[string]any{
+			"UserId":   cr.user.ID,
+			"Username": cr.user.Username,
+		},
+		History: history,
+		Status:  prog.Status,
+	}
+	if streaming.Enabled {
+		req.Stream = prog.Chunk
+	}
 
-		// Show user request in embed title during processing
-		processingTitle := fmt.Sprintf("Processing: %s", CropText(userInput, 200))
-		statusEmbed := createEmbed(processingTitle, description, footer)
-		if err := sendInteractionResponseEdit(s, i, statusEmbed); err != nil {
-			slog.Warn("Unable to update status", slog.String("error", err.Error()))
+	if len(cr.attachments) > 0 {
+		if !a.model.SupportsImages(req.Profile) {
+			prog.Close()
+			_ = r.Edit(createEmbed(embedAuthorError, "The current model does not support images. Send your message without attachments.", ""), nil, nil)
+			return
+		}
+		prog.Status("🖼️ Downloading images...")
+		imagesCtx, imagesSpan := tracing.Start(ctx, "images", attribute.Int("images", len(cr.attachments)))
+		images, err := a.downloadImages(imagesCtx, cr.attachments)
+		tracing.End(imagesSpan, err)
+		if err != nil {
+			prog.Close()
+			if errors.Is(context.Cause(ctx), errShuttingDown) {
+				_ = r.Edit(restartingEmbed(), nil, nil)
+				return
+			}
+			slog.Warn("Unable to download images", slog.String("error", err.Error()))
+			_ = r.Edit(createEmbed(embedAuthorError, err.Error(), ""), nil, nil)
+			return
 		}
+		req.Images = images
 	}
 
-	resp, err := a.model.ChatWithStatus(ctx, escapedInput, map[string]any{
-		"UserId":   i.Member.User.ID,
-		"Username": i.Member.User.Username,
-	}, statusCallback)
+	resp, err := a.model.Generate(ctx, req)
+	prog.Close()
+	a.logRequest(jb, cr, resp, err, context.Cause(ctx))
+	tracing.Fail(span, err)
+	if resp != nil {
+		span.SetAttributes(
+			attribute.Int("model.input_tokens", resp.Usage.InputTokens),
+			attribute.Int("model.output_tokens", resp.Usage.OutputTokens),
+			attribute.Int("model.turns", resp.Usage.Turns),
+		)
+	}
 	if err != nil {
+		if errors.Is(context.Cause(ctx), errShuttingDown) {
+			_ = r.Edit(restartingEmbed(), nil, nil)
+			return
+		}
+		if cancel, ok := context.Cause(ctx).(*cancelError); ok {
+			_ = r.Edit(cancelledEmbed(cr, prog, cancel), nil, nil)
+			return
+		}
 		slog.Error("Unable to chat", slog.String("error", err.Error()))
 		errorEmbed := createEmbed(embedAuthorError, err.Error(), "")
-		if err := sendInteractionResponseEdit(s, i, errorEmbed); err != nil {
+		if err := r.Edit(errorEmbed, nil, nil); err != nil {
 			return
 		}
 		return
 	}
-	end := time.Now()
-
-	// Mark final status as completed
-	if len(statusHistory) > 0 {
-		lastIdx := len(statusHistory) - 1
-		statusHistory[lastIdx] = emojiRegex.ReplaceAllString(statusHistory[lastIdx], "✅")
-	}
+	elapsed := prog.Elapsed()
 
 	var result string
-	if data := ExtractAfterLastThinkTag(resp); len(data) > 0 {
-		result = CropText(data, 4096)
+	if len(resp.Text) > 0 {
+		result = resp.Text
+		// Later turns in the channel are kept, the new answer is appended after them then
+		if !a.memory.ReplaceTail(cr.channelID, cr.replaces, resp.Messages...) {
+			a.memory.Append(cr.channelID, resp.Messages...)
+		}
 	} else {
 		result = "AI was thinking too hard so it provided no response... Try again later."
 	}
 
+	// The buttons below the answer need the request and the conversation
+	cr.replaces = nil
+	a.answers.Put(cr.id, &answer{
+		request:   cr,
+		history:   history,
+		messages:  resp.Messages,
+		reasoning: resp.Reasoning,
+	})
+
+	footer := fmt.Sprintf("Response time: %.2fs", elapsed.Seconds())
+	if speed := resp.Usage.TokensPerSecond(); speed > 0 && a.conf().cfg.Usage.TokensPerSecond {
+		footer += fmt.Sprintf(" • %.1f tokens/s", speed)
+	}
+
 	// Create clean final response without process history
-	chatEmbed := createEmbed(
-		fmt.Sprintf("Chat: %s", CropText(userInput, 240)),
-		CropText(result, 4096), // Full space for AI response
-		fmt.Sprintf("Response time: %.2fs", end.Sub(start).Seconds()),
-	)
+	if err := sendAnswer(r,
+		cr.title,
+		result,
+		footer,
+		answerComponents(cr.id, resp.Reasoning != ""),
+	); err != nil {
+		return
+	}
 
-	if err := sendInteractionResponseEdit(s, i, chatEmbed); err != nil {
+	if cr.thread != "" && len(resp.Text) > 0 {
+		if err := a.startThread(r, cr, result, resp.Messages); err != nil {
+			slog.Error("Unable to start thread", slog.String("error", err.Error()))
+			_ = r.Followup(createEmbed(embedAuthorError, fmt.Sprintf("Unable to start a thread: %s", err.Error()), ""))
+		}
+	}
+}
+
+// thinkingHandler shows the reasoning of the answer privately to the user who clicked "Show thinking".
+func (a *App) thinkingHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, id := parseCustomID(i.MessageComponentData().CustomID)
+	ans, ok := a.answers.Get(id)
+	if !ok || ans.reasoning == "" {
+		errorEmbed := createEmbed(embedAuthorError, "Reasoning of this answer is no longer available.", "")
+		_ = sendInteractionResponse(s, i, errorEmbed, discordgo.MessageFlagsEphemeral)
 		return
 	}
+	_ = sendEphemeralPages(s, i, embedAuthorReasoning, ans.reasoning)
+}
+
+func (a *App) resetHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	a.memory.Reset(i.ChannelID)
+	resetEmbed := createEmbed(embedAuthorReset, "Conversation history in this channel has been cleared.", "")
+	_ = sendInteractionResponse(s, i, resetEmbed, 0)
+}
+
+// logRequest records the generation in the request log.
+func (a *App) logRequest(jb *job, cr chatRequest, resp *model.Response, err, cause error) {
+	entry := &storage.RequestLog{
+		ID:        jb.id,
+		UserID:    jb.user.ID,
+		GuildID:   jb.guildID,
+		ChannelID: jb.channelID,
+		Profile:   cr.profile,
+		Model:     a.model.Profile(cr.profile).ModelName,
+		Started:   jb.started,
+		Duration:  time.Since(jb.started),
+		Status:    storage.StatusOK,
+	}
+	if resp != nil {
+		entry.InputTokens, entry.OutputTokens = resp.Usage.InputTokens, resp.Usage.OutputTokens
+	}
+	// The request itself was counted when it was allowed
+	a.limiter.Record(entry.UserID, entry.GuildID, entry.Started, entry.InputTokens+entry.OutputTokens)
+	var cancelled *cancelError
+	switch {
+	case errors.As(cause, &cancelled), errors.Is(cause, errShuttingDown):
+		entry.Status = storage.StatusCancelled
+	case err != nil:
+		entry.Status = storage.StatusError
+		entry.Error = err.Error()
+	}
+	a.outcome(cr.id, cr.command, entry.Status)
+	if err := a.store.LogRequest(entry); err != nil {
+		slog.Warn("Unable to log request", slog.String("error", err.Error()))
+	}
 }
 
 func (a *App) thinkingResponse(s *discordgo.Session, i *discordgo.InteractionCreate) error {
@@ -172,3 +433,17 @@ func (a *App) errorResponse(s *discordgo.Session, i *discordgo.InteractionCreate
 	errorEmbed := createEmbed(embedAuthorError, description, "")
 	return sendInteractionResponse(s, i, errorEmbed, discordgo.MessageFlagsLoading)
 }
+
+func (a *App) restartingResponse(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	return sendInteractionResponse(s, i, restartingEmbed(), discordgo.MessageFlagsEphemeral)
+}
+
+// restartingEmbed replaces answers that were interrupted by a shutdown.
+func restartingEmbed() *discordgo.MessageEmbed {
+	return createEmbed(embedAuthorRestarting, "The bot is restarting, so this request was stopped. Please try again in a minute.", "")
+}
+
+func (a *App) deniedResponse(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	errorEmbed := createEmbed(embedAuthorError, "You are not allowed to use this bot here.", "")
+	return sendInteractionResponse(s, i, errorEmbed, discordgo.MessageFlagsEphemeral)
+}
@@ -1,6 +1,10 @@
 package main
 
-import "strings"
+import (
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/FlameInTheDark/disai/internal/access"
+)
 
 func CropText(input string, length int) string {
 	runes := []rune(input)
@@ -11,11 +15,44 @@ func CropText(input string, length int) string {
 	return string(runes[:length-3]) + "..."
 }
 
-func ExtractAfterLastThinkTag(input string) string {
-	tag := "\n</think>\n\n"
-	idx := strings.LastIndex(input, tag)
-	if idx == -1 {
-		return strings.TrimSpace(input)
+// TailText keeps the last length runes of the input, prefixed with "..." when cut.
+func TailText(input string, length int) string {
+	runes := []rune(input)
+	if len(runes) <= length {
+		return input
+	}
+	if length <= 3 {
+		return ""
+	}
+	return "..." + string(runes[len(runes)-length+3:])
+}
+
+// interactionUser returns the user who triggered the interaction in both guilds and DMs.
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+// interactionSubject describes the user of the interaction for access checks and limits.
+func interactionSubject(i *discordgo.InteractionCreate) access.Subject {
+	subject := access.Subject{
+		UserID:    interactionUser(i).ID,
+		GuildID:   i.GuildID,
+		ChannelID: i.ChannelID,
+	}
+	if i.Member != nil {
+		subject.Roles = i.Member.Roles
+	}
+	return subject
+}
+
+// commandOptions maps the options of a slash command by name.
+func commandOptions(i *discordgo.InteractionCreate) map[string]*discordgo.ApplicationCommandInteractionDataOption {
+	options := make(map[string]*discordgo.ApplicationCommandInteractionDataOption)
+	for _, opt := range i.ApplicationCommandData().Options {
+		options[opt.Name] = opt
 	}
-	return strings.TrimSpace(input[idx+len(tag):])
+	return options
 }
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// errShuttingDown cancels the chats still running when the shutdown deadline passes.
+var errShuttingDown = errors.New("the bot is restarting")
+
+// job is a chat that is being generated.
+type job struct {
+	id        string
+	user      *discordgo.User
+	guildID   string
+	channelID string
+	input     string
+	r         replier
+	started   time.Time
+	cancel    context.CancelCauseFunc
+}
+
+// cancelError is the cause of a job cancelled with the Stop button, /cancel or /jobs.
+type cancelError struct {
+	user *discordgo.User
+	at   time.Time
+}
+
+func (e *cancelError) Error() string {
+	return "cancelled by " + e.user.Username
+}
+
+// cancelBy cancels the job on behalf of the user.
+func (jb *job) cancelBy(user *discordgo.User) {
+	jb.cancel(&cancelError{user: user, at: time.Now()})
+}
+
+// jobRegistry tracks running chats, so they can be drained on shutdown.
+type jobRegistry struct {
+	mu     sync.Mutex
+	jobs   map[string]*job
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func newJobRegistry() *jobRegistry {
+	return &jobRegistry{jobs: make(map[string]*job)}
+}
+
+// start registers the job, it returns false when the registry no longer accepts jobs.
+func (j *jobRegistry) start(jb *job) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.closed {
+		return false
+	}
+	j.jobs[jb.id] = jb
+	j.wg.Add(1)
+	return true
+}
+
+// finish removes the job once its answer or error was delivered.
+func (j *jobRegistry) finish(id string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.jobs[id]; !ok {
+		return
+	}
+	delete(j.jobs, id)
+	j.wg.Done()
+}
+
+// get returns the running job with the given ID.
+func (j *jobRegistry) get(id string) (*job, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	jb, ok := j.jobs[id]
+	return jb, ok
+}
+
+// close stops accepting new jobs.
+func (j *jobRegistry) close() {
+	j.mu.Lock()
+	j.closed = true
+	j.mu.Unlock()
+}
+
+// closing reports whether the registry stopped accepting jobs.
+func (j *jobRegistry) closing() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.closed
+}
+
+// cancelAll cancels every running job with the cause.
+func (j *jobRegistry) cancelAll(cause error) int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, jb := range j.jobs {
+		jb.cancel(cause)
+	}
+	return len(j.jobs)
+}
+
+// wait blocks until all jobs are finished or the context is done.
+// It returns false when jobs are still running.
+func (j *jobRegistry) wait(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		j.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// remaining returns the jobs that are still running, oldest first.
+func (j *jobRegistry) remaining() []*job {
+	return j.filter(func(*job) bool { return true })
+}
+
+// byUser returns the running jobs of the user, oldest first.
+func (j *jobRegistry) byUser(userID string) []*job {
+	return j.filter(func(jb *job) bool { return jb.user.ID == userID })
+}
+
+func (j *jobRegistry) filter(keep func(*job) bool) []*job {
+	j.mu.Lock()
+	out := make([]*job, 0, len(j.jobs))
+	for _, jb := range j.jobs {
+		if keep(jb) {
+			out = append(out, jb)
+		}
+	}
+	j.mu.Unlock()
+	sort.Slice(out, func(a, b int) bool { return out[a].started.Before(out[b].started) })
+	return out
+}
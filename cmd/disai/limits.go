@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/FlameInTheDark/disai/internal/access"
+	"github.com/FlameInTheDark/disai/internal/ratelimit"
+)
+
+const embedAuthorLimited = "Slow down"
+
+// limited checks the rate limits and quotas of the subject. Failing to read the
+// request log does not block anyone.
+func (a *App) limited(id string, subject access.Subject, command string) (*ratelimit.LimitError, bool) {
+	err := a.limiter.Allow(a.conf().cfg.Limits, subject)
+	if err == nil {
+		return nil, false
+	}
+	var limit *ratelimit.LimitError
+	if errors.As(err, &limit) {
+		a.outcome(id, command, outcomeLimited)
+		slog.Info("Request limited", slog.String("user", subject.UserID), slog.String("guild", subject.GuildID), slog.String("reason", limit.Reason))
+		return limit, true
+	}
+	slog.Warn("Unable to check limits", slog.String("error", err.Error()))
+	return nil, false
+}
+
+// limitedInteraction tells the user privately when they can try again.
+func (a *App) limitedInteraction(s *discordgo.Session, i *discordgo.InteractionCreate, command string) bool {
+	limit, ok := a.limited(i.ID, interactionSubject(i), command)
+	if ok {
+		_ = sendInteractionResponse(s, i, limitedEmbed(limit), discordgo.MessageFlagsEphemeral)
+	}
+	return ok
+}
+
+func limitedEmbed(limit *ratelimit.LimitError) *discordgo.MessageEmbed {
+	return createEmbed(embedAuthorLimited, fmt.Sprintf("%s. You can try again <t:%d:R>.", limit.Reason, limit.RetryAt.Unix()), "")
+}
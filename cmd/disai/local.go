@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/urfave/cli/v3"
+
+	"github.com/FlameInTheDark/disai/internal/config"
+	"github.com/FlameInTheDark/disai/internal/mcp"
+	"github.com/FlameInTheDark/disai/internal/model"
+)
+
+// localUser identifies terminal sessions in the request queue
+const localUser = "cli"
+
+// localCommands run the model from the terminal without connecting to Discord.
+func localCommands() []*cli.Command {
+	profileFlag := &cli.StringFlag{
+		Name:  "profile",
+		Usage: "model profile, the default profile when empty",
+	}
+	thinkingFlag := &cli.BoolFlag{
+		Name:  "thinking",
+		Usage: "print the reasoning of the model",
+	}
+	return []*cli.Command{
+		{
+			Name:      "ask",
+			Usage:     "ask the model once and print the answer",
+			ArgsUsage: "<message>",
+			Flags:     []cli.Flag{profileFlag, thinkingFlag},
+			Action:    askAction,
+		},
+		{
+			Name:   "repl",
+			Usage:  "chat with the model in the terminal",
+			Flags:  []cli.Flag{profileFlag, thinkingFlag},
+			Action: replAction,
+		},
+		{
+			Name:  "tools",
+			Usage: "inspect the MCP tools",
+			Commands: []*cli.Command{
+				{
+					Name:   "list",
+					Usage:  "list the tools of all MCP servers",
+					Action: toolsListAction,
+				},
+			},
+		},
+	}
+}
+
+// localModel builds the model from the config file given with --config.
+func localModel(c *cli.Command) (*model.Model, error) {
+	cfg, err := config.NewLocalConfig(c.String("config"))
+	if err != nil {
+		return nil, err
+	}
+	mcpClient, err := mcp.NewClient(cfg.MCPServers)
+	if err != nil {
+		return nil, err
+	}
+	pool := model.NewPool(cfg.OllamaServers, cfg.Balancing, cfg.Queue)
+	m, err := model.NewModel(cfg, pool, mcpClient)
+	if err != nil {
+		return nil, err
+	}
+	if profile := c.String("profile"); profile != "" && !m.HasProfile(profile) {
+		return nil, fmt.Errorf("unknown profile %q", profile)
+	}
+	return m, nil
+}
+
+// terminalRequest prints status lines and reasoning to stderr and streams the answer to stdout.
+func terminalRequest(c *cli.Command, message string, history []*ai.Message) model.Request {
+	t := &terminal{thinking: c.Bool("thinking")}
+	return model.Request{
+		Profile: c.String("profile"),
+		User:    localUser,
+		Message: message,
+		History: history,
+		Status:  t.status,
+		Stream:  t.chunk,
+	}
+}
+
+// terminal keeps status lines, reasoning and the answer on separate lines.
+type terminal struct {
+	thinking bool
+	// open is the stream with an unfinished line, nil at the start of a line
+	open *os.File
+}
+
+func (t *terminal) status(status string) {
+	t.endLine()
+	fmt.Fprintln(os.Stderr, status)
+}
+
+func (t *terminal) chunk(chunk model.Chunk) {
+	out := os.Stdout
+	// Printed text can not be taken back, the reasoning is already on the screen
+	if chunk.Moved {
+		return
+	}
+	if chunk.Thinking {
+		if !t.thinking {
+			return
+		}
+		out = os.Stderr
+	}
+	if t.open != out {
+		t.endLine()
+	}
+	fmt.Fprint(out, chunk.Text)
+	t.open = out
+}
+
+func (t *terminal) endLine() {
+	if t.open != nil {
+		fmt.Fprintln(t.open)
+		t.open = nil
+	}
+}
+
+func askAction(ctx context.Context, c *cli.Command) error {
+	message := strings.TrimSpace(strings.Join(c.Args().Slice(), " "))
+	if message == "" {
+		return errors.New("no message provided, usage: disai ask \"message\"")
+	}
+	m, err := localModel(c)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	_, err = m.Generate(ctx, terminalRequest(c, message, nil))
+	return err
+}
+
+func replAction(ctx context.Context, c *cli.Command) error {
+	m, err := localModel(c)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	fmt.Fprintln(os.Stderr, "Type a message, /reset to clear the history or /exit to quit. Ctrl+C stops the answer.")
+
+	var history []*ai.Message
+	in := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Fprint(os.Stderr, "> ")
+		if !in.Scan() {
+			fmt.Fprintln(os.Stderr)
+			return in.Err()
+		}
+		line := strings.TrimSpace(in.Text())
+		switch line {
+		case "":
+			continue
+		case "/exit", "/quit":
+			return nil
+		case "/reset":
+			history = nil
+			fmt.Fprintln(os.Stderr, "History cleared")
+			continue
+		}
+
+		turnCtx, stop := signal.NotifyContext(ctx, os.Interrupt)
+		resp, err := m.Generate(turnCtx, terminalRequest(c, line, history))
+		stop()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			continue
+		}
+		history = append(history, resp.Messages...)
+	}
+}
+
+func toolsListAction(ctx context.Context, c *cli.Command) error {
+	m, err := localModel(c)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	tools, err := m.Tools(ctx)
+	if err != nil {
+		return err
+	}
+	if len(tools) == 0 {
+		fmt.Fprintln(os.Stderr, "No tools found")
+		return nil
+	}
+	return printTools(os.Stdout, m, tools)
+}
+
+func printTools(out io.Writer, m *model.Model, tools []ai.Tool) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATUS\tDESCRIPTION")
+	for _, t := range tools {
+		desc, _, _ := strings.Cut(t.Definition().Description, "\n")
+		fmt.Fprintf(w, "%s\t%s\t%s\n", t.Name(), m.ToolName(t.Name()), CropText(desc, 80))
+	}
+	return w.Flush()
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -24,23 +25,67 @@ func main() {
 				Value:   "./config.yaml",
 			},
 		},
+		Commands: append(localCommands(), &cli.Command{
+			Name:  "config",
+			Usage: "work with the config file",
+			Commands: []*cli.Command{
+				{
+					Name:   "check",
+					Usage:  "validate the config file and the templates",
+					Action: checkConfig,
+				},
+			},
+		}),
 		Action: func(ctx context.Context, c *cli.Command) error {
-			cfg := config.NewConfig(c.String("config"))
-			app := NewApp(cfg)
-			err := app.Run()
+			path := c.String("config")
+			cfg, err := config.NewConfig(path)
+			if err != nil {
+				return err
+			}
+			app, err := NewApp(cfg)
+			if err != nil {
+				return err
+			}
+			err = app.Run()
 			if err != nil {
 				return err
 			}
-			app.createCommands()
 			app.registerHandlers()
+			if err := app.syncCommands(); err != nil {
+				return err
+			}
+
+			watchCtx, stopWatch := context.WithCancel(ctx)
+			defer stopWatch()
+			go app.watchConfig(watchCtx, path)
+
 			slog.Info("Up and running")
 			signalCh := make(chan os.Signal, 1)
 			signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
 			<-signalCh
+			// A second signal skips waiting for running chats
+			go func() {
+				<-signalCh
+				slog.Warn("Forced shutdown")
+				os.Exit(1)
+			}()
+			stopWatch()
+			app.Shutdown()
 			return nil
 		},
 	}
 	if err := cmd.Run(context.Background(), os.Args); err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// checkConfig validates the config without connecting to Discord or the model servers.
+func checkConfig(ctx context.Context, c *cli.Command) error {
+	path := c.String("config")
+	if _, err := config.NewConfig(path); err != nil {
+		return err
 	}
+	fmt.Printf("%s is valid\n", path)
+	return nil
 }
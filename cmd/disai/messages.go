@@ -0,0 +1,170 @@
+package main
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/firebase/genkit/go/ai"
+
+	"github.com/FlameInTheDark/disai/internal/access"
+)
+
+var mentionRegex = regexp.MustCompile(`<@!?(\d+)>`)
+
+// messageHandler answers messages that mention the bot or reply to one of its messages.
+func (a *App) messageHandler(s *discordgo.Session, m *discordgo.MessageCreate) {
+	if m.Author == nil || m.Author.Bot || a.jobs.closing() {
+		return
+	}
+	botID := s.State.User.ID
+	// Threads started by the bot continue the conversation without mentions
+	inThread := isBotThread(s, m.GuildID, m.ChannelID, botID)
+	if !inThread {
+		if !mentionedOrReplied(m.Message, botID) {
+			return
+		}
+		if !a.mentionsEnabled(m.GuildID, m.ChannelID) {
+			return
+		}
+	}
+
+	subject := access.Subject{
+		UserID:    m.Author.ID,
+		GuildID:   m.GuildID,
+		ChannelID: m.ChannelID,
+	}
+	if m.Member != nil {
+		subject.Roles = m.Member.Roles
+	}
+	if !a.conf().access.Allowed(subject) {
+		slog.Info("Access denied", slog.String("user", subject.UserID), slog.String("guild", subject.GuildID), slog.String("channel", subject.ChannelID))
+		return
+	}
+
+	userInput := stripMentions(m.Content, botID)
+	images := imageAttachments(m.Attachments)
+	if userInput == "" {
+		if len(images) == 0 {
+			return
+		}
+		userInput = defaultImagePrompt
+	}
+
+	if limit, ok := a.limited(m.ID, subject, commandMention); ok {
+		// Messages can not be answered privately, the reply does not ping the user
+		_, _ = s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+			Embeds:          []*discordgo.MessageEmbed{limitedEmbed(limit)},
+			Reference:       m.Reference(),
+			AllowedMentions: &discordgo.MessageAllowedMentions{RepliedUser: false},
+		})
+		return
+	}
+
+	// Send “Thinking…” reply
+	reply, err := s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Embeds:    []*discordgo.MessageEmbed{createEmbed(embedAuthorThinking, "", "")},
+		Reference: m.Reference(),
+		AllowedMentions: &discordgo.MessageAllowedMentions{
+			RepliedUser: false,
+		},
+	})
+	if err != nil {
+		slog.Error("Unable to send reply", slog.String("error", err.Error()))
+		return
+	}
+
+	cr := chatRequest{
+		id:        m.ID,
+		command:   commandMention,
+		user:      m.Author,
+		guildID:   m.GuildID,
+		channelID: m.ChannelID,
+		input:     userInput,
+
+		attachments: images,
+	}
+	// In threads the history is scoped to the thread itself
+	if !inThread {
+		cr.history = a.replyChain(s, m.Message, botID)
+	}
+	a.chat(&messageReplier{s: s, channelID: m.ChannelID, messageID: reply.ID}, cr)
+}
+
+// mentionedOrReplied reports whether the message mentions the bot or replies to its message.
+func mentionedOrReplied(m *discordgo.Message, botID string) bool {
+	for _, u := range m.Mentions {
+		if u.ID == botID {
+			return true
+		}
+	}
+	return m.ReferencedMessage != nil && m.ReferencedMessage.Author != nil && m.ReferencedMessage.Author.ID == botID
+}
+
+// mentionsEnabled checks the per-channel toggle, then the per-guild one, then the default.
+func (a *App) mentionsEnabled(guildID, channelID string) bool {
+	mentions := a.conf().mentions
+	if enabled, ok := mentions.Channels[channelID]; ok {
+		return enabled
+	}
+	if enabled, ok := mentions.Guilds[guildID]; ok {
+		return enabled
+	}
+	return mentions.Enabled
+}
+
+// replyChain follows the replies of the message and converts them into conversation
+// history, oldest message first. Messages of the bot become model messages.
+func (a *App) replyChain(s *discordgo.Session, m *discordgo.Message, botID string) []*ai.Message {
+	var chain []*ai.Message
+	cur := m.ReferencedMessage
+	for depth := 0; cur != nil && depth < a.conf().mentions.MaxReplyDepth; depth++ {
+		if msg := chainMessage(cur, botID); msg != nil {
+			chain = append([]*ai.Message{msg}, chain...)
+		}
+		ref := cur.MessageReference
+		if ref == nil || ref.MessageID == "" {
+			break
+		}
+		// Referenced messages are only included one level deep, so fetch the next one
+		next, err := s.ChannelMessage(ref.ChannelID, ref.MessageID)
+		if err != nil {
+			slog.Warn("Unable to fetch replied message", slog.String("error", err.Error()))
+			break
+		}
+		cur = next
+	}
+	return chain
+}
+
+func chainMessage(m *discordgo.Message, botID string) *ai.Message {
+	if m.Author != nil && m.Author.ID == botID {
+		var parts []string
+		for _, embed := range m.Embeds {
+			if embed.Description != "" {
+				parts = append(parts, embed.Description)
+			}
+		}
+		if len(parts) == 0 {
+			return nil
+		}
+		return ai.NewModelTextMessage(strings.Join(parts, "\n\n"))
+	}
+	text := stripMentions(m.Content, botID)
+	if text == "" {
+		return nil
+	}
+	return ai.NewUserTextMessage(text)
+}
+
+// stripMentions removes mentions of the bot from the message content.
+func stripMentions(content, botID string) string {
+	content = mentionRegex.ReplaceAllStringFunc(content, func(mention string) string {
+		if mentionRegex.FindStringSubmatch(mention)[1] == botID {
+			return ""
+		}
+		return mention
+	})
+	return strings.TrimSpace(content)
+}
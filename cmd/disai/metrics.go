@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/FlameInTheDark/disai/internal/metrics"
+)
+
+// Commands and outcomes of the request metrics besides the request log statuses.
+const (
+	commandChat    = "chat"
+	commandMention = "mention"
+
+	outcomeLimited      = "limited"
+	outcomeDenied       = "denied"
+	outcomePanic        = "panic"
+	outcomeShutdown     = "shutdown"
+	outcomeUnhandled    = "unhandled"
+	outcomeAutocomplete = "autocomplete"
+)
+
+// outcome records the outcome of a request. Interactions are counted by the router
+// once their handler returns, other requests like mentions are counted right away.
+func (a *App) outcome(id, command, outcome string) {
+	if a.router != nil && a.router.report(id, outcome) {
+		return
+	}
+	metrics.Request(command, outcome)
+}
+
+// registerMetrics adds the gauges that are read from the app on every scrape.
+func (a *App) registerMetrics() {
+	metrics.Register(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "disai_queue_length",
+			Help: "Jobs waiting for a free Ollama server.",
+		}, func() float64 { return float64(a.pool.QueueLength()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "disai_running_jobs",
+			Help: "Answers that are queued or being generated.",
+		}, func() float64 { return float64(len(a.jobs.remaining())) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "disai_gateway_latency_seconds",
+			Help: "Latency of the last Discord gateway heartbeat.",
+		}, func() float64 { return a.s.HeartbeatLatency().Seconds() }),
+	)
+	for _, b := range a.pool.Backends() {
+		labels := prometheus.Labels{"backend": b.Name}
+		metrics.Register(
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name:        "disai_backend_up",
+				Help:        "Whether the Ollama server passed the last health check or request.",
+				ConstLabels: labels,
+			}, func() float64 {
+				if b.Healthy() {
+					return 1
+				}
+				return 0
+			}),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name:        "disai_backend_inflight",
+				Help:        "Requests running on the Ollama server.",
+				ConstLabels: labels,
+			}, func() float64 { return float64(b.InFlight()) }),
+		)
+	}
+}
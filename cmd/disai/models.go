@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Values of the "scope" option of /model
+const (
+	scopeUser  = "user"
+	scopeGuild = "guild"
+)
+
+const embedAuthorProfiles = "Model profiles"
+
+// profileFor returns the profile picked by the user, then the one picked for the guild.
+// An empty result means the default profile.
+func (a *App) profileFor(userID, guildID string) string {
+	if p := a.settings.UserProfile(userID); p != "" && a.model.HasProfile(p) {
+		return p
+	}
+	if guildID != "" {
+		if p := a.settings.GuildProfile(guildID); p != "" && a.model.HasProfile(p) {
+			return p
+		}
+	}
+	return a.model.DefaultProfile()
+}
+
+func (a *App) modelHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	user := interactionUser(i)
+	options := commandOptions(i)
+
+	opt, ok := options["profile"]
+	if !ok {
+		a.listProfiles(s, i, a.profileFor(user.ID, i.GuildID))
+		return
+	}
+	name := strings.TrimSpace(opt.StringValue())
+	if !a.model.HasProfile(name) {
+		_ = sendInteractionResponse(s, i, createEmbed(embedAuthorError, fmt.Sprintf("Unknown profile %q.", name), ""), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	scope := scopeUser
+	if opt, ok := options["scope"]; ok {
+		scope = opt.StringValue()
+	}
+
+	var (
+		err    error
+		target string
+	)
+	switch scope {
+	case scopeGuild:
+		if i.GuildID == "" || i.Member == nil {
+			_ = sendInteractionResponse(s, i, createEmbed(embedAuthorError, "Server profiles can only be set in a server.", ""), discordgo.MessageFlagsEphemeral)
+			return
+		}
+		if i.Member.Permissions&discordgo.PermissionManageGuild == 0 {
+			_ = sendInteractionResponse(s, i, createEmbed(embedAuthorError, "You need the Manage Server permission to set the server profile.", ""), discordgo.MessageFlagsEphemeral)
+			return
+		}
+		err = a.settings.SetGuildProfile(i.GuildID, name)
+		target = "this server"
+	default:
+		err = a.settings.SetUserProfile(user.ID, name)
+		target = "you"
+	}
+	if err != nil {
+		slog.Error("Unable to save profile", slog.String("error", err.Error()))
+		_ = sendInteractionResponse(s, i, createEmbed(embedAuthorError, "Unable to save the profile.", ""), discordgo.MessageFlagsEphemeral)
+		return
+	}
+	_ = sendInteractionResponse(s, i, createEmbed(embedAuthorProfiles, fmt.Sprintf("Profile **%s** is now used for %s.", name, target), ""), discordgo.MessageFlagsEphemeral)
+}
+
+func (a *App) listProfiles(s *discordgo.Session, i *discordgo.InteractionCreate, current string) {
+	var lines []string
+	for _, p := range a.model.Profiles() {
+		line := fmt.Sprintf("**%s** (`%s`)", p.Name, p.ModelName)
+		if p.Description != "" {
+			line += " — " + p.Description
+		}
+		if p.Name == current {
+			line = "✅ " + line
+		}
+		lines = append(lines, line)
+	}
+	_ = sendInteractionResponse(s, i, createEmbed(embedAuthorProfiles, CropText(strings.Join(lines, "\n"), embedDescriptionLimit), "Use /model profile:<name> to switch"), discordgo.MessageFlagsEphemeral)
+}
+
+// modelAutocomplete suggests profiles matching what the user typed.
+func (a *App) modelAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var typed string
+	for _, opt := range i.ApplicationCommandData().Options {
+		if opt.Focused {
+			typed = strings.ToLower(opt.StringValue())
+		}
+	}
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, p := range a.model.Profiles() {
+		if typed != "" && !strings.Contains(strings.ToLower(p.Name), typed) {
+			continue
+		}
+		label := p.Name
+		if p.Description != "" {
+			label += " — " + p.Description
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: CropText(label, 100), Value: p.Name})
+		if len(choices) == 25 {
+			break
+		}
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+	if err != nil {
+		slog.Error("Unable to send autocomplete", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const fenceMarker = "```"
+
+// block is a paragraph or a whole code block of a markdown message.
+type block struct {
+	text string
+	// fence is the opening fence line of a code block, empty for paragraphs
+	fence string
+}
+
+// SplitMessage splits markdown text into pages of at most limit runes.
+// Pages break on paragraph boundaries first, then on line boundaries.
+// A code block cut by a page break is closed and reopened on the next page,
+// so every page renders on its own.
+func SplitMessage(text string, limit int) []string {
+	text = strings.TrimSpace(text)
+	if utf8.RuneCountInString(text) <= limit {
+		return []string{text}
+	}
+
+	var (
+		pages []string
+		cur   string
+	)
+	flush := func() {
+		if strings.TrimSpace(cur) != "" {
+			pages = append(pages, cur)
+		}
+		cur = ""
+	}
+	for _, b := range parseBlocks(text) {
+		switch {
+		case cur == "" && runeLen(b.text) <= limit:
+			cur = b.text
+		case cur != "" && runeLen(cur)+2+runeLen(b.text) <= limit:
+			cur += "\n\n" + b.text
+		default:
+			flush()
+			pieces := splitBlock(b, limit)
+			if len(pieces) == 0 {
+				continue
+			}
+			pages = append(pages, pieces[:len(pieces)-1]...)
+			cur = pieces[len(pieces)-1]
+		}
+	}
+	flush()
+	return pages
+}
+
+// parseBlocks splits text into paragraphs and code blocks. Blank lines inside
+// code blocks do not end the block.
+func parseBlocks(text string) []block {
+	var (
+		blocks []block
+		lines  []string
+		fence  string
+	)
+	push := func() {
+		if len(lines) > 0 {
+			blocks = append(blocks, block{text: strings.Join(lines, "\n"), fence: fence})
+		}
+		lines = nil
+	}
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence == "" && strings.HasPrefix(trimmed, fenceMarker):
+			push()
+			fence = trimmed
+			lines = append(lines, line)
+		case fence != "" && trimmed == fenceMarker:
+			lines = append(lines, line)
+			push()
+			fence = ""
+		case fence == "" && trimmed == "":
+			push()
+		default:
+			lines = append(lines, line)
+		}
+	}
+	if fence != "" {
+		// Close a code block the model forgot to close
+		lines = append(lines, fenceMarker)
+	}
+	push()
+	return blocks
+}
+
+// splitBlock splits a single block that does not fit into a page.
+// Code blocks whose fence line alone does not fit are split like paragraphs.
+func splitBlock(b block, limit int) []string {
+	lines := strings.Split(b.text, "\n")
+	budget := limit - runeLen(b.fence) - runeLen(fenceMarker) - 2
+	if b.fence == "" || budget <= 0 {
+		return packLines(lines, limit)
+	}
+	inner := lines[1:]
+	if n := len(inner); n > 0 && strings.TrimSpace(inner[n-1]) == fenceMarker {
+		inner = inner[:n-1]
+	}
+	var pieces []string
+	for _, piece := range packLines(inner, budget) {
+		pieces = append(pieces, b.fence+"\n"+piece+"\n"+fenceMarker)
+	}
+	return pieces
+}
+
+// packLines joins lines into pieces of at most limit runes, hard-splitting lines that are too long.
+func packLines(lines []string, limit int) []string {
+	var (
+		pieces []string
+		cur    string
+		has    bool
+	)
+	for _, line := range lines {
+		for _, part := range hardSplit(line, limit) {
+			if has && runeLen(cur)+1+runeLen(part) <= limit {
+				cur += "\n" + part
+				continue
+			}
+			if has {
+				pieces = append(pieces, cur)
+			}
+			cur, has = part, true
+		}
+	}
+	if has {
+		pieces = append(pieces, cur)
+	}
+	return pieces
+}
+
+// hardSplit cuts a line into parts of at most limit runes, preferring spaces.
+func hardSplit(line string, limit int) []string {
+	if limit <= 0 {
+		return []string{line}
+	}
+	var parts []string
+	runes := []rune(line)
+	for len(runes) > limit {
+		cut := limit
+		if idx := strings.LastIndex(string(runes[:limit]), " "); idx > 0 {
+			cut = utf8.RuneCountInString(string(runes[:limit])[:idx])
+		}
+		parts = append(parts, string(runes[:cut]))
+		runes = []rune(strings.TrimLeft(string(runes[cut:]), " "))
+	}
+	return append(parts, string(runes))
+}
+
+func runeLen(s string) int {
+	return utf8.RuneCountInString(s)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitMessage(t *testing.T) {
+	code := "```go\n" + strings.Repeat("fmt.Println(\"hello\")\n", 300) + "```"
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		pages int
+	}{
+		{name: "short", text: "hello", limit: 100, pages: 1},
+		{name: "empty", text: "", limit: 100, pages: 1},
+		{name: "paragraphs", text: strings.Repeat("a", 60) + "\n\n" + strings.Repeat("b", 60), limit: 100, pages: 2},
+		{name: "long line", text: strings.Repeat("word ", 100), limit: 100, pages: 5},
+		{name: "code block", text: code, limit: 1000},
+		{name: "unclosed code block", text: "```\n" + strings.Repeat("x\n", 500), limit: 100},
+		{name: "fence line longer than the limit", text: "```" + strings.Repeat("x", 5000), limit: 4096, pages: 2},
+		{name: "empty code block", text: strings.Repeat("a", 150) + "\n\n```\n```", limit: 100},
+		{name: "tiny limit", text: "```go\n" + strings.Repeat("x", 50) + "\n```", limit: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages := SplitMessage(tt.text, tt.limit)
+			if tt.pages > 0 && len(pages) != tt.pages {
+				t.Errorf("got %d pages, want %d", len(pages), tt.pages)
+			}
+			if len(pages) == 0 {
+				t.Fatal("got no pages")
+			}
+			if len(pages) == 1 {
+				return
+			}
+			for i, page := range pages {
+				if n := runeLen(page); n > tt.limit {
+					t.Errorf("page %d has %d runes, limit is %d", i, n, tt.limit)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitMessageClosesCodeBlocks(t *testing.T) {
+	text := "Intro\n\n```go\n" + strings.Repeat("x := 1\n", 200) + "```\n\nOutro"
+	for i, page := range SplitMessage(text, 300) {
+		if n := strings.Count(page, fenceMarker); n%2 != 0 {
+			t.Errorf("page %d has %d fences:\n%s", i, n, page)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/FlameInTheDark/disai/internal/model"
+)
+
+// progress renders the status history and the streamed answer of a running
+// chat into the response embed. Streamed text is flushed at most once per
+// interval to stay under Discord edit rate limits.
+type progress struct {
+	r          replier
+	components []discordgo.MessageComponent
+	title      string
+	start      time.Time
+	interval   time.Duration
+
+	mu        sync.Mutex
+	statuses  []string
+	answer    strings.Builder
+	reasoning strings.Builder
+	dirty     bool
+
+	// editMu keeps edits in the order they were rendered
+	editMu sync.Mutex
+	stop   chan struct{}
+	done   sync.WaitGroup
+}
+
+func newProgress(r replier, userInput string, interval time.Duration, components []discordgo.MessageComponent) *progress {
+	p := &progress{
+		r:          r,
+		components: components,
+		title:      fmt.Sprintf("Processing: %s", CropText(userInput, 200)),
+		start:      time.Now(),
+		interval:   interval,
+		stop:       make(chan struct{}),
+	}
+	p.done.Add(1)
+	go p.loop()
+	return p
+}
+
+// Status adds a status line and updates the embed right away.
+func (p *progress) Status(status string) {
+	p.mu.Lock()
+	// Queue positions replace each other instead of piling up
+	if n := len(p.statuses); n > 0 && strings.HasPrefix(status, model.QueueStatusPrefix) && strings.HasPrefix(p.statuses[n-1], model.QueueStatusPrefix) {
+		p.statuses[n-1] = status
+	} else {
+		p.statuses = append(p.statuses, status)
+	}
+	p.dirty = true
+	p.mu.Unlock()
+	p.flush()
+}
+
+// Chunk collects streamed output, it is shown on the next tick.
+func (p *progress) Chunk(chunk model.Chunk) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if chunk.Moved {
+		p.answer.Reset()
+	}
+	if chunk.Thinking {
+		p.reasoning.WriteString(chunk.Text)
+	} else {
+		p.answer.WriteString(chunk.Text)
+	}
+	p.dirty = true
+}
+
+// Close stops the periodic updates. Pending output is dropped because the
+// caller replaces the embed with the final answer.
+func (p *progress) Close() {
+	close(p.stop)
+	p.done.Wait()
+}
+
+// Text returns the answer streamed so far.
+func (p *progress) Text() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return strings.TrimSpace(p.answer.String())
+}
+
+// Elapsed returns the time since the chat started.
+func (p *progress) Elapsed() time.Duration {
+	return time.Since(p.start)
+}
+
+func (p *progress) loop() {
+	defer p.done.Done()
+	if p.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.flush()
+		}
+	}
+}
+
+func (p *progress) flush() {
+	p.editMu.Lock()
+	defer p.editMu.Unlock()
+
+	p.mu.Lock()
+	if !p.dirty {
+		p.mu.Unlock()
+		return
+	}
+	p.dirty = false
+	embed := p.render()
+	p.mu.Unlock()
+
+	if err := p.r.Edit(embed, p.components, nil); err != nil {
+		slog.Warn("Unable to update status", slog.String("error", err.Error()))
+	}
+}
+
+// render builds the embed, must be called with the mutex held.
+func (p *progress) render() *discordgo.MessageEmbed {
+	var lines []string
+	for i, s := range p.statuses {
+		if i < len(p.statuses)-1 {
+			// Previous status, mark as completed
+			lines = append(lines, emojiRegex.ReplaceAllString(s, "✅"))
+		} else {
+			lines = append(lines, s)
+		}
+	}
+	description := strings.Join(lines, "\n")
+	if answer := strings.TrimSpace(p.answer.String()); answer != "" {
+		description += "\n\n" + TailText(answer, 4096-len([]rune(description))-2)
+	}
+
+	embed := createEmbed(p.title, description, fmt.Sprintf("Elapsed: %.1fs", p.Elapsed().Seconds()))
+	if reasoning := strings.TrimSpace(p.reasoning.String()); reasoning != "" && p.answer.Len() == 0 {
+		embed.Fields = []*discordgo.MessageEmbedField{{
+			Name:  "💭 Reasoning",
+			Value: TailText(reasoning, 1024),
+		}}
+	}
+	return embed
+}
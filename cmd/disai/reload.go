@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/FlameInTheDark/disai/internal/access"
+	"github.com/FlameInTheDark/disai/internal/config"
+)
+
+// reloadDelay groups the bursts of file events editors produce on save
+const reloadDelay = 500 * time.Millisecond
+
+// liveConfig holds the config sections that can change while the bot is running.
+type liveConfig struct {
+	cfg       config.Config
+	access    *access.Checker
+	streaming config.Streaming
+	mentions  config.Mentions
+	threads   config.Threads
+	images    config.Images
+}
+
+func newLiveConfig(cfg config.Config) *liveConfig {
+	return &liveConfig{
+		cfg:       cfg,
+		access:    access.NewChecker(cfg.Access, cfg.Whitelist),
+		streaming: cfg.Streaming,
+		mentions:  cfg.Mentions,
+		threads:   cfg.Threads,
+		images:    cfg.Images,
+	}
+}
+
+// conf returns the active config sections.
+func (a *App) conf() *liveConfig {
+	return a.live.Load()
+}
+
+// reloadConfig re-reads the config file and the templates and swaps them in.
+// On error the active configuration is kept.
+func (a *App) reloadConfig(path string) error {
+	cfg, err := config.NewConfig(path)
+	if err != nil {
+		return err
+	}
+	if err := a.model.Reload(cfg); err != nil {
+		return err
+	}
+	old := a.conf().cfg
+	a.live.Store(newLiveConfig(cfg))
+
+	if changed := restartOnly(old, cfg); len(changed) > 0 {
+		slog.Warn("Changes that need a restart are ignored", slog.String("sections", strings.Join(changed, ", ")))
+	}
+	return nil
+}
+
+// restartOnly returns the names of changed config sections that are only read at startup.
+func restartOnly(old, cfg config.Config) []string {
+	var changed []string
+	check := func(name string, a, b any) {
+		if !reflect.DeepEqual(a, b) {
+			changed = append(changed, name)
+		}
+	}
+	check("token", old.Token, cfg.Token)
+	check("mcpServers", old.MCPServers, cfg.MCPServers)
+	check("ollamaServers", old.OllamaServers, cfg.OllamaServers)
+	check("balancing", old.Balancing, cfg.Balancing)
+	check("queue", old.Queue, cfg.Queue)
+	check("storage", old.Storage, cfg.Storage)
+	check("chatOverrides", old.ChatOverrides, cfg.ChatOverrides)
+	check("memory", old.Memory, cfg.Memory)
+	check("commands", old.Commands, cfg.Commands)
+	check("metrics", old.Metrics, cfg.Metrics)
+	check("tracing", old.Tracing, cfg.Tracing)
+	// The message content intent is only requested at startup
+	if !old.Mentions.Any() && cfg.Mentions.Any() {
+		changed = append(changed, "mentions")
+	}
+	return changed
+}
+
+// watchedFiles returns the config file and all templates it references.
+func watchedFiles(path string, cfg config.Config) map[string]bool {
+	files := map[string]bool{}
+	add := func(name string) {
+		if name == "" {
+			return
+		}
+		if abs, err := filepath.Abs(name); err == nil {
+			files[abs] = true
+		}
+	}
+	add(path)
+	profiles, _ := cfg.ModelProfiles()
+	for _, p := range profiles {
+		add(p.Templates.System)
+		add(p.Templates.User)
+	}
+	return files
+}
+
+// watchConfig reloads the config on SIGHUP and when the config file or a template changes.
+func (a *App) watchConfig(ctx context.Context, path string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var (
+		events <-chan fsnotify.Event
+		errs   <-chan error
+		files  map[string]bool
+	)
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		slog.Error("Unable to watch the config, only SIGHUP reloads it", slog.String("error", err.Error()))
+	} else {
+		defer watcher.Close()
+		events, errs = watcher.Events, watcher.Errors
+	}
+	// Editors often replace files on save, so the directories are watched instead of the files
+	watch := func() {
+		if watcher == nil {
+			return
+		}
+		files = watchedFiles(path, a.conf().cfg)
+		for file := range files {
+			if err := watcher.Add(filepath.Dir(file)); err != nil {
+				slog.Warn("Unable to watch directory", slog.String("dir", filepath.Dir(file)), slog.String("error", err.Error()))
+			}
+		}
+	}
+	reload := func(reason string) {
+		if err := a.reloadConfig(path); err != nil {
+			slog.Error("Config reload rejected, keeping the active config", slog.String("reason", reason), slog.String("error", err.Error()))
+			return
+		}
+		slog.Info("Config reloaded", slog.String("reason", reason))
+		watch()
+	}
+	watch()
+
+	var (
+		timer   *time.Timer
+		pending <-chan time.Time
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			reload("SIGHUP")
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if !files[filepath.Clean(ev.Name)] || !ev.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename) {
+				continue
+			}
+			if timer == nil {
+				timer = time.NewTimer(reloadDelay)
+			} else {
+				timer.Reset(reloadDelay)
+			}
+			pending = timer.C
+		case <-pending:
+			pending = nil
+			reload("file changed")
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			slog.Warn("Config watcher error", slog.String("error", err.Error()))
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// replier delivers chat progress and answers, either by editing an
+// interaction response or by editing a regular message sent by the bot.
+type replier interface {
+	// Edit replaces the embed, components and attaches files to the response.
+	Edit(embed *discordgo.MessageEmbed, components []discordgo.MessageComponent, files []*discordgo.File) error
+	// Followup sends an additional message after the response.
+	Followup(embed *discordgo.MessageEmbed) error
+	// Message returns the response message.
+	Message() (*discordgo.Message, error)
+}
+
+// interactionReplier edits the response of a slash command.
+type interactionReplier struct {
+	s *discordgo.Session
+	i *discordgo.InteractionCreate
+}
+
+func (r *interactionReplier) Edit(embed *discordgo.MessageEmbed, components []discordgo.MessageComponent, files []*discordgo.File) error {
+	if components == nil {
+		components = []discordgo.MessageComponent{}
+	}
+	respEdit := &discordgo.WebhookEdit{
+		Embeds:     &[]*discordgo.MessageEmbed{embed},
+		Components: &components,
+		Files:      files,
+	}
+	if _, err := r.s.InteractionResponseEdit(r.i.Interaction, respEdit); err != nil {
+		slog.Error("Unable to send response", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+func (r *interactionReplier) Followup(embed *discordgo.MessageEmbed) error {
+	params := &discordgo.WebhookParams{Embeds: []*discordgo.MessageEmbed{embed}}
+	if _, err := r.s.FollowupMessageCreate(r.i.Interaction, true, params); err != nil {
+		slog.Error("Unable to send follow-up", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+func (r *interactionReplier) Message() (*discordgo.Message, error) {
+	return r.s.InteractionResponse(r.i.Interaction)
+}
+
+// messageReplier edits a message the bot sent as a reply to a user message.
+type messageReplier struct {
+	s         *discordgo.Session
+	channelID string
+	messageID string
+}
+
+func (r *messageReplier) Edit(embed *discordgo.MessageEmbed, components []discordgo.MessageComponent, files []*discordgo.File) error {
+	if components == nil {
+		components = []discordgo.MessageComponent{}
+	}
+	edit := &discordgo.MessageEdit{
+		ID:         r.messageID,
+		Channel:    r.channelID,
+		Embeds:     &[]*discordgo.MessageEmbed{embed},
+		Components: &components,
+		Files:      files,
+	}
+	if _, err := r.s.ChannelMessageEditComplex(edit); err != nil {
+		slog.Error("Unable to edit message", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+func (r *messageReplier) Followup(embed *discordgo.MessageEmbed) error {
+	msg := &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{embed},
+		Reference: &discordgo.MessageReference{
+			MessageID: r.messageID,
+			ChannelID: r.channelID,
+		},
+	}
+	if _, err := r.s.ChannelMessageSendComplex(r.channelID, msg); err != nil {
+		slog.Error("Unable to send follow-up", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+func (r *messageReplier) Message() (*discordgo.Message, error) {
+	return r.s.ChannelMessage(r.channelID, r.messageID)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/FlameInTheDark/disai/internal/metrics"
+	"github.com/FlameInTheDark/disai/internal/storage"
+)
+
+// router dispatches interactions on their type: slash commands and autocomplete
+// by the command name, components and modals by the prefix of the custom ID.
+type router struct {
+	commands     map[string]handlerFunc
+	autocomplete map[string]handlerFunc
+	components   map[string]handlerFunc
+	modals       map[string]handlerFunc
+	// outcomes of the interactions being handled by interaction ID, counted when the handler returns
+	outcomes sync.Map
+}
+
+func newRouter() *router {
+	return &router{
+		commands:     make(map[string]handlerFunc),
+		autocomplete: make(map[string]handlerFunc),
+		components:   make(map[string]handlerFunc),
+		modals:       make(map[string]handlerFunc),
+	}
+}
+
+// customID builds a custom ID that is routed to the handler registered for prefix.
+func customID(prefix, argument string) string {
+	return prefix + ":" + argument
+}
+
+// parseCustomID splits custom IDs like "prefix:argument".
+func parseCustomID(id string) (prefix, argument string) {
+	prefix, argument, _ = strings.Cut(id, ":")
+	return prefix, argument
+}
+
+// customIDPrefix returns the routing part of the custom ID.
+func customIDPrefix(id string) string {
+	prefix, _ := parseCustomID(id)
+	return prefix
+}
+
+// match returns the handler of the interaction and whether it has to pass the access check.
+func (r *router) match(i *discordgo.InteractionCreate) (handlerFunc, bool) {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		return r.commands[i.ApplicationCommandData().Name], true
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		// Suggestions reveal nothing, denied users are stopped when they run the command
+		return r.autocomplete[i.ApplicationCommandData().Name], false
+	case discordgo.InteractionMessageComponent:
+		return r.components[customIDPrefix(i.MessageComponentData().CustomID)], true
+	case discordgo.InteractionModalSubmit:
+		return r.modals[customIDPrefix(i.ModalSubmitData().CustomID)], true
+	}
+	return nil, false
+}
+
+// report sets the outcome of an interaction that is being handled.
+// It returns false when the ID does not belong to such an interaction.
+func (r *router) report(id, outcome string) bool {
+	if _, ok := r.outcomes.Load(id); !ok {
+		return false
+	}
+	r.outcomes.Store(id, outcome)
+	return true
+}
+
+// interactionName returns the command name or the custom ID prefix of the interaction.
+func interactionName(i *discordgo.InteractionCreate) string {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand, discordgo.InteractionApplicationCommandAutocomplete:
+		return i.ApplicationCommandData().Name
+	case discordgo.InteractionMessageComponent:
+		return customIDPrefix(i.MessageComponentData().CustomID)
+	case discordgo.InteractionModalSubmit:
+		return customIDPrefix(i.ModalSubmitData().CustomID)
+	}
+	return i.Type.String()
+}
+
+// handleInteraction routes the interaction to its handler.
+func (a *App) handleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	defer a.recoverInteraction(s, i)
+
+	name := interactionName(i)
+	// No new work is accepted while shutting down
+	if a.jobs.closing() {
+		if i.Type != discordgo.InteractionApplicationCommandAutocomplete {
+			_ = a.restartingResponse(s, i)
+		}
+		metrics.Request(name, outcomeShutdown)
+		return
+	}
+	h, guarded := a.router.match(i)
+	if h == nil {
+		metrics.Request(name, outcomeUnhandled)
+		slog.Warn("Unhandled interaction", slog.String("type", i.Type.String()), slog.String("id", i.ID))
+		return
+	}
+	if guarded {
+		h = a.guard(h)
+	}
+
+	// Handlers report other outcomes than ok, e.g. a limited chat or a failed generation
+	outcome := storage.StatusOK
+	if i.Type == discordgo.InteractionApplicationCommandAutocomplete {
+		outcome = outcomeAutocomplete
+	}
+	a.router.outcomes.Store(i.ID, outcome)
+	h(s, i)
+	if v, ok := a.router.outcomes.LoadAndDelete(i.ID); ok {
+		metrics.Request(name, v.(string))
+	}
+}
+
+// recoverInteraction stops a panicking handler from taking the bot down and tells the user.
+func (a *App) recoverInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	a.router.outcomes.Delete(i.ID)
+	metrics.Request(interactionName(i), outcomePanic)
+	slog.Error("Interaction handler panicked", slog.String("type", i.Type.String()), slog.Any("panic", r), slog.String("stack", string(debug.Stack())))
+	if i.Type == discordgo.InteractionApplicationCommandAutocomplete {
+		return
+	}
+	embed := createEmbed(embedAuthorError, "Something went wrong while handling this request.", "")
+	// The handler may have responded already, then only a follow-up is possible
+	if err := sendInteractionResponse(s, i, embed, discordgo.MessageFlagsEphemeral); err != nil {
+		_, _ = s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+			Embeds: []*discordgo.MessageEmbed{embed},
+			Flags:  discordgo.MessageFlagsEphemeral,
+		})
+	}
+}
+
+// recoverEvent logs a panic in a gateway event handler.
+func recoverEvent(event string) {
+	if r := recover(); r != nil {
+		slog.Error("Event handler panicked", slog.String("event", event), slog.String("panic", fmt.Sprint(r)), slog.String("stack", string(debug.Stack())))
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// Values of the "thread" option of /chat
+const (
+	threadPublic  = "public"
+	threadPrivate = "private"
+)
+
+var errThreadOutsideGuild = errors.New("threads are only available in servers")
+
+// startThread creates a thread for the conversation and seeds its history with
+// the messages of the answer. Public threads start from the answer message,
+// private threads get a copy of the answer and the requester is invited.
+func (a *App) startThread(r replier, cr chatRequest, answer string, messages []*ai.Message) error {
+	if cr.guildID == "" {
+		return errThreadOutsideGuild
+	}
+	start := &discordgo.ThreadStart{
+		Name:                CropText(cr.input, 100),
+		AutoArchiveDuration: a.conf().threads.AutoArchive,
+	}
+
+	var (
+		thread *discordgo.Channel
+		err    error
+	)
+	switch cr.thread {
+	case threadPrivate:
+		start.Type = discordgo.ChannelTypeGuildPrivateThread
+		start.Invitable = true
+		thread, err = a.s.ThreadStartComplex(cr.channelID, start)
+		if err != nil {
+			return err
+		}
+		if err := a.s.ThreadMemberAdd(thread.ID, cr.user.ID); err != nil {
+			return err
+		}
+		pages := SplitMessage(answer, embedDescriptionLimit)
+		for n, page := range pages[:min(len(pages), maxAnswerPages)] {
+			title := fmt.Sprintf("Chat: %s", CropText(cr.input, 240))
+			if n > 0 {
+				title = fmt.Sprintf("Page %d/%d", n+1, len(pages))
+			}
+			if _, err := a.s.ChannelMessageSendEmbed(thread.ID, createEmbed(title, page, "")); err != nil {
+				return err
+			}
+		}
+	default:
+		msg, err := r.Message()
+		if err != nil {
+			return err
+		}
+		thread, err = a.s.MessageThreadStartComplex(cr.channelID, msg.ID, start)
+		if err != nil {
+			return err
+		}
+	}
+
+	a.memory.Append(thread.ID, messages...)
+	slog.Info("Thread started", slog.String("thread", thread.ID), slog.String("user", cr.user.ID))
+	return nil
+}
+
+// isBotThread reports whether the channel is a thread started by the bot.
+// Every message in such a thread continues the conversation.
+// Channels missing from the state are fetched once and cached there.
+func isBotThread(s *discordgo.Session, guildID, channelID, botID string) bool {
+	if guildID == "" {
+		return false
+	}
+	ch, err := s.State.Channel(channelID)
+	if err != nil {
+		ch, err = s.Channel(channelID)
+		if err != nil {
+			return false
+		}
+		if err := s.State.ChannelAdd(ch); err != nil {
+			slog.Debug("Unable to cache the channel", slog.String("channel", channelID), slog.String("error", err.Error()))
+		}
+	}
+	return ch.IsThread() && ch.OwnerID == botID
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/FlameInTheDark/disai/internal/storage"
+)
+
+const (
+	embedAuthorUsage = "Usage"
+
+	leaderboardUsers   = "users"
+	leaderboardGuilds  = "guilds"
+	leaderboardModels  = "models"
+	leaderboardEntries = 10
+)
+
+// usagePeriods are the choices of the period option, in days.
+var usagePeriods = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "today", Value: 1},
+	{Name: "last 7 days", Value: 7},
+	{Name: "last 30 days", Value: 30},
+}
+
+// usageTotals sums the request log entries of a user, guild or model.
+type usageTotals struct {
+	key          string
+	requests     int
+	errors       int
+	inputTokens  int
+	outputTokens int
+}
+
+func (t *usageTotals) add(r *storage.RequestLog) {
+	t.requests++
+	if r.Status == storage.StatusError {
+		t.errors++
+	}
+	t.inputTokens += r.InputTokens
+	t.outputTokens += r.OutputTokens
+}
+
+func (t *usageTotals) tokens() int {
+	return t.inputTokens + t.outputTokens
+}
+
+// usageHandler shows the usage of the user, admins can see leaderboards.
+func (a *App) usageHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	user := interactionUser(i)
+	options := commandOptions(i)
+	days := 7
+	if opt, ok := options["period"]; ok {
+		days = int(opt.IntValue())
+	}
+	// Periods start at midnight UTC like the daily quotas
+	now := time.Now()
+	from := now.UTC().Truncate(24*time.Hour).AddDate(0, 0, 1-days)
+	period := fmt.Sprintf("Since %s", from.Format(time.DateOnly))
+
+	if opt, ok := options["leaderboard"]; ok {
+		if !a.conf().access.Admin(user.ID) {
+			_ = a.deniedResponse(s, i)
+			return
+		}
+		board, err := a.leaderboard(opt.StringValue(), from, now)
+		if err != nil {
+			a.usageError(s, i, err)
+			return
+		}
+		_ = sendInteractionResponse(s, i, createEmbed(embedAuthorUsage, board, period), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	byModel, err := a.usage(from, now, func(r *storage.RequestLog) string {
+		if r.UserID != user.ID {
+			return ""
+		}
+		return r.Model
+	})
+	if err != nil {
+		a.usageError(s, i, err)
+		return
+	}
+	if len(byModel) == 0 {
+		_ = sendInteractionResponse(s, i, createEmbed(embedAuthorUsage, "You have not asked anything yet.", period), discordgo.MessageFlagsEphemeral)
+		return
+	}
+	total := &usageTotals{}
+	lines := make([]string, 0, len(byModel)+2)
+	for _, t := range byModel {
+		total.requests += t.requests
+		total.errors += t.errors
+		total.inputTokens += t.inputTokens
+		total.outputTokens += t.outputTokens
+		lines = append(lines, fmt.Sprintf("`%s` %s", t.key, usageLine(t)))
+	}
+	lines = append([]string{fmt.Sprintf("**Total** %s", usageLine(total)), ""}, lines...)
+	_ = sendInteractionResponse(s, i, createEmbed(embedAuthorUsage, CropText(strings.Join(lines, "\n"), embedDescriptionLimit), period), discordgo.MessageFlagsEphemeral)
+}
+
+// leaderboard lists the users, guilds or models with the most tokens.
+func (a *App) leaderboard(kind string, from, to time.Time) (string, error) {
+	key := func(r *storage.RequestLog) string { return r.UserID }
+	format := func(id string) string { return "<@" + id + ">" }
+	switch kind {
+	case leaderboardGuilds:
+		key = func(r *storage.RequestLog) string { return r.GuildID }
+		format = func(id string) string { return "`" + id + "`" }
+	case leaderboardModels:
+		key = func(r *storage.RequestLog) string { return r.Model }
+		format = func(id string) string { return "`" + id + "`" }
+	}
+	totals, err := a.usage(from, to, key)
+	if err != nil {
+		return "", err
+	}
+	if len(totals) == 0 {
+		return "Nothing was asked yet.", nil
+	}
+	lines := make([]string, 0, leaderboardEntries)
+	for n, t := range totals[:min(len(totals), leaderboardEntries)] {
+		lines = append(lines, fmt.Sprintf("%d. %s %s", n+1, format(t.key), usageLine(t)))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// usage sums the request log between from and to by the key of every entry,
+// entries with an empty key are skipped. The result is sorted by tokens.
+func (a *App) usage(from, to time.Time, key func(*storage.RequestLog) string) ([]*usageTotals, error) {
+	byKey := make(map[string]*usageTotals)
+	err := a.store.Requests(from, to, func(r *storage.RequestLog) error {
+		k := key(r)
+		if k == "" {
+			return nil
+		}
+		t, ok := byKey[k]
+		if !ok {
+			t = &usageTotals{key: k}
+			byKey[k] = t
+		}
+		t.add(r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	totals := make([]*usageTotals, 0, len(byKey))
+	for _, t := range byKey {
+		totals = append(totals, t)
+	}
+	slices.SortFunc(totals, func(x, y *usageTotals) int {
+		return cmp.Or(cmp.Compare(y.tokens(), x.tokens()), cmp.Compare(y.requests, x.requests), strings.Compare(x.key, y.key))
+	})
+	return totals, nil
+}
+
+func usageLine(t *usageTotals) string {
+	line := fmt.Sprintf("%d requests, %d tokens (%d in, %d out)", t.requests, t.tokens(), t.inputTokens, t.outputTokens)
+	if t.errors > 0 {
+		line += fmt.Sprintf(", %d failed", t.errors)
+	}
+	return line
+}
+
+func (a *App) usageError(s *discordgo.Session, i *discordgo.InteractionCreate, err error) {
+	slog.Error("Unable to read the request log", slog.String("error", err.Error()))
+	_ = sendInteractionResponse(s, i, createEmbed(embedAuthorError, "Unable to read the usage, try again later.", ""), discordgo.MessageFlagsEphemeral)
+}
@@ -0,0 +1,104 @@
+package access
+
+import (
+	"strconv"
+
+	"github.com/FlameInTheDark/disai/internal/config"
+)
+
+// Subject describes who is trying to use the bot and where.
+type Subject struct {
+	UserID    string
+	GuildID   string
+	ChannelID string
+	Roles     []string
+}
+
+// Checker decides whether a subject is allowed to use the bot.
+// Deny entries always win. When no allow entries are configured everyone
+// who is not denied is allowed, otherwise the subject must match at least one
+// allow entry.
+type Checker struct {
+	allow  list
+	deny   list
+	admins map[string]struct{}
+}
+
+type list struct {
+	users    map[string]struct{}
+	guilds   map[string]struct{}
+	channels map[string]struct{}
+	roles    map[string]struct{}
+}
+
+// NewChecker builds a Checker from the access config. Legacy whitelist entries
+// are treated as allowed user IDs.
+func NewChecker(cfg config.Access, whitelist []int64) *Checker {
+	allow := newList(cfg.Allow)
+	for _, id := range whitelist {
+		allow.users[strconv.FormatInt(id, 10)] = struct{}{}
+	}
+	return &Checker{
+		allow:  allow,
+		deny:   newList(cfg.Deny),
+		admins: toSet(cfg.Admins),
+	}
+}
+
+// Admin reports whether the user may manage the bot.
+func (c *Checker) Admin(userID string) bool {
+	_, ok := c.admins[userID]
+	return ok
+}
+
+// Allowed reports whether the subject may use the bot.
+func (c *Checker) Allowed(s Subject) bool {
+	if c.deny.matches(s) {
+		return false
+	}
+	if c.allow.empty() {
+		return true
+	}
+	return c.allow.matches(s)
+}
+
+func newList(l config.AccessList) list {
+	return list{
+		users:    toSet(l.Users),
+		guilds:   toSet(l.Guilds),
+		channels: toSet(l.Channels),
+		roles:    toSet(l.Roles),
+	}
+}
+
+func (l list) empty() bool {
+	return len(l.users) == 0 && len(l.guilds) == 0 && len(l.channels) == 0 && len(l.roles) == 0
+}
+
+func (l list) matches(s Subject) bool {
+	if contains(l.users, s.UserID) || contains(l.guilds, s.GuildID) || contains(l.channels, s.ChannelID) {
+		return true
+	}
+	for _, role := range s.Roles {
+		if contains(l.roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(set map[string]struct{}, id string) bool {
+	if id == "" {
+		return false
+	}
+	_, ok := set[id]
+	return ok
+}
+
+func toSet(ids []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,92 @@
+package access
+
+import (
+	"testing"
+
+	"github.com/FlameInTheDark/disai/internal/config"
+)
+
+func TestCheckerAllowed(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       config.Access
+		whitelist []int64
+		subject   Subject
+		want      bool
+	}{
+		{
+			name:    "everyone without allow entries",
+			subject: Subject{UserID: "1", GuildID: "g"},
+			want:    true,
+		},
+		{
+			name:    "denied user",
+			cfg:     config.Access{Deny: config.AccessList{Users: []string{"1"}}},
+			subject: Subject{UserID: "1"},
+			want:    false,
+		},
+		{
+			name:    "allowed guild",
+			cfg:     config.Access{Allow: config.AccessList{Guilds: []string{"g"}}},
+			subject: Subject{UserID: "1", GuildID: "g"},
+			want:    true,
+		},
+		{
+			name:    "not in the allow list",
+			cfg:     config.Access{Allow: config.AccessList{Guilds: []string{"g"}}},
+			subject: Subject{UserID: "1", GuildID: "other"},
+			want:    false,
+		},
+		{
+			name:    "allowed role",
+			cfg:     config.Access{Allow: config.AccessList{Roles: []string{"r"}}},
+			subject: Subject{UserID: "1", GuildID: "g", Roles: []string{"x", "r"}},
+			want:    true,
+		},
+		{
+			name: "deny wins over allow",
+			cfg: config.Access{
+				Allow: config.AccessList{Guilds: []string{"g"}},
+				Deny:  config.AccessList{Channels: []string{"c"}},
+			},
+			subject: Subject{UserID: "1", GuildID: "g", ChannelID: "c"},
+			want:    false,
+		},
+		{
+			name:      "legacy whitelist",
+			whitelist: []int64{42},
+			subject:   Subject{UserID: "42"},
+			want:      true,
+		},
+		{
+			name:      "legacy whitelist restricts",
+			whitelist: []int64{42},
+			subject:   Subject{UserID: "43"},
+			want:      false,
+		},
+		{
+			name:    "empty guild in DMs does not match",
+			cfg:     config.Access{Allow: config.AccessList{Guilds: []string{""}}},
+			subject: Subject{UserID: "1"},
+			want:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChecker(tt.cfg, tt.whitelist)
+			if got := c.Allowed(tt.subject); got != tt.want {
+				t.Errorf("Allowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckerAdmin(t *testing.T) {
+	c := NewChecker(config.Access{Admins: []string{"1"}}, nil)
+	if !c.Admin("1") {
+		t.Error("user 1 should be an admin")
+	}
+	if c.Admin("2") {
+		t.Error("user 2 should not be an admin")
+	}
+}
@@ -1,15 +1,47 @@
 package config
 
-import "github.com/ilyakaznacheev/cleanenv"
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
 
 type Config struct {
 	Token         string               `yaml:"token" env:"DISCORD_TOKEN"`
 	MCPServers    map[string]MCPServer `yaml:"mcpServers"`
 	OllamaServers map[string]string    `yaml:"ollamaServers"`
+	Balancing     Balancing            `yaml:"balancing"`
+	Queue         Queue                `yaml:"queue"`
 	Model         string               `yaml:"model"`
-	Whitelist     []int64              `yaml:"whitelist"`
-	Templates     Templates            `yaml:"templates"`
-	ToolNames     map[string]string    `yaml:"toolNames"`
+	// Profiles are named model configurations users can pick with /model.
+	// When empty, a "default" profile is built from Model and Templates.
+	Profiles       map[string]Profile `yaml:"profiles"`
+	DefaultProfile string             `yaml:"defaultProfile"`
+	Storage        Storage            `yaml:"storage"`
+	// Generation holds the default generation options of all profiles.
+	Generation Generation `yaml:"generation"`
+	// ChatOverrides lists the generation options users may set with /chat arguments,
+	// see ChatOverrideNames.
+	ChatOverrides []string `yaml:"chatOverrides"`
+	// ModelCapabilities describes what the models can do, keyed by model name.
+	ModelCapabilities map[string]Capabilities `yaml:"modelCapabilities"`
+	Images            Images                  `yaml:"images"`
+	Whitelist         []int64                 `yaml:"whitelist"`
+	Access            Access                  `yaml:"access"`
+	Templates         Templates               `yaml:"templates"`
+	ToolNames         map[string]string       `yaml:"toolNames"`
+	Memory            Memory                  `yaml:"memory"`
+	Streaming         Streaming               `yaml:"streaming"`
+	Mentions          Mentions                `yaml:"mentions"`
+	Threads           Threads                 `yaml:"threads"`
+	Shutdown          Shutdown                `yaml:"shutdown"`
+	Commands          Commands                `yaml:"commands"`
+	Limits            Limits                  `yaml:"limits"`
+	Usage             Usage                   `yaml:"usage"`
+	Metrics           Metrics                 `yaml:"metrics"`
+	Tracing           Tracing                 `yaml:"tracing"`
 }
 
 type MCPServer struct {
@@ -19,16 +51,312 @@ type MCPServer struct {
 	Env     []string `yaml:"env"`
 }
 
+// Profile is a named model configuration with its own templates and tool set.
+type Profile struct {
+	Description string `yaml:"description"`
+	Model       string `yaml:"model"`
+	// Generation options of the profile override the global ones.
+	Generation `yaml:",inline"`
+	Templates  Templates `yaml:"templates"`
+	// Tools limits the profile to these tool names, all tools are available when empty.
+	Tools []string `yaml:"tools"`
+}
+
+// Generation holds the Ollama generation options. Unset options keep the Ollama defaults.
+type Generation struct {
+	Temperature *float64 `yaml:"temperature"`
+	TopP        *float64 `yaml:"topP"`
+	TopK        *int     `yaml:"topK"`
+	// ContextSize is the context window (num_ctx) in tokens.
+	ContextSize *int `yaml:"contextSize"`
+	// NumPredict limits the number of generated tokens, -1 means no limit.
+	NumPredict    *int     `yaml:"numPredict"`
+	RepeatPenalty *float64 `yaml:"repeatPenalty"`
+	Seed          *int     `yaml:"seed"`
+	// KeepAlive is how long the model stays loaded after a request, e.g. "5m", negative keeps it loaded.
+	KeepAlive string `yaml:"keepAlive"`
+}
+
+// Or returns the options with unset fields taken from def.
+func (g Generation) Or(def Generation) Generation {
+	if g.Temperature == nil {
+		g.Temperature = def.Temperature
+	}
+	if g.TopP == nil {
+		g.TopP = def.TopP
+	}
+	if g.TopK == nil {
+		g.TopK = def.TopK
+	}
+	if g.ContextSize == nil {
+		g.ContextSize = def.ContextSize
+	}
+	if g.NumPredict == nil {
+		g.NumPredict = def.NumPredict
+	}
+	if g.RepeatPenalty == nil {
+		g.RepeatPenalty = def.RepeatPenalty
+	}
+	if g.Seed == nil {
+		g.Seed = def.Seed
+	}
+	if g.KeepAlive == "" {
+		g.KeepAlive = def.KeepAlive
+	}
+	return g
+}
+
+// Capabilities describes what a model supports besides text.
+type Capabilities struct {
+	// Vision allows image attachments (llava, qwen2.5vl, gemma3...).
+	Vision bool `yaml:"vision"`
+}
+
+// ChatOverrideNames are the generation options that can be enabled in ChatOverrides.
+var ChatOverrideNames = []string{"temperature", "top_p", "top_k", "num_predict", "repeat_penalty", "seed"}
+
+// Images limits image attachments sent to vision models, zero values disable a limit.
+type Images struct {
+	MaxSize  int64 `yaml:"maxSize"`
+	MaxCount int   `yaml:"maxCount"`
+}
+
+// Access holds allow and deny lists of Discord IDs. Deny entries take precedence.
+type Access struct {
+	Allow AccessList `yaml:"allow"`
+	Deny  AccessList `yaml:"deny"`
+	// Admins are user IDs allowed to manage the bot, e.g. with /jobs.
+	Admins []string `yaml:"admins"`
+}
+
+type AccessList struct {
+	Users    []string `yaml:"users"`
+	Guilds   []string `yaml:"guilds"`
+	Channels []string `yaml:"channels"`
+	Roles    []string `yaml:"roles"`
+}
+
+// Balancing controls how requests are spread across the Ollama servers.
+type Balancing struct {
+	// Strategy is either "round-robin" or "least-busy".
+	Strategy       string        `yaml:"strategy" env-default:"round-robin"`
+	HealthInterval time.Duration `yaml:"healthInterval"`
+	// RequestTimeout limits a single model turn on one server before failing over.
+	RequestTimeout time.Duration `yaml:"requestTimeout"`
+	Retries        int           `yaml:"retries"`
+}
+
+// Queue limits how many jobs run on every Ollama server and how many jobs
+// a single user may have queued. Zero values disable the corresponding limit.
+type Queue struct {
+	// Concurrency is the default number of jobs running at once on a server.
+	Concurrency int `yaml:"concurrency"`
+	// Servers overrides Concurrency per server name from ollamaServers.
+	Servers    map[string]int `yaml:"servers"`
+	MaxPerUser int            `yaml:"maxPerUser"`
+	MaxSize    int            `yaml:"maxSize"`
+}
+
+// Memory limits the conversation history kept per channel or thread.
+// Zero values disable the corresponding limit.
+type Memory struct {
+	MaxTurns  int           `yaml:"maxTurns"`
+	MaxTokens int           `yaml:"maxTokens"`
+	TTL       time.Duration `yaml:"ttl"`
+}
+
+// Streaming controls progressive updates of the answer embed.
+type Streaming struct {
+	Enabled bool `yaml:"enabled"`
+	// EditInterval is the minimum time between two embed edits.
+	// Zero shows only the status lines until the answer is finished.
+	EditInterval time.Duration `yaml:"editInterval"`
+}
+
+// Mentions controls answering messages that mention the bot or reply to it.
+// Channel toggles take precedence over guild toggles, which take precedence over Enabled.
+type Mentions struct {
+	Enabled  bool            `yaml:"enabled"`
+	Guilds   map[string]bool `yaml:"guilds"`
+	Channels map[string]bool `yaml:"channels"`
+	// MaxReplyDepth limits how many replied messages are used as context, zero uses none.
+	MaxReplyDepth int `yaml:"maxReplyDepth"`
+}
+
+// Any reports whether mentions are answered in at least one place.
+func (m Mentions) Any() bool {
+	if m.Enabled {
+		return true
+	}
+	for _, enabled := range m.Guilds {
+		if enabled {
+			return true
+		}
+	}
+	for _, enabled := range m.Channels {
+		if enabled {
+			return true
+		}
+	}
+	return false
+}
+
+// Threads configures threads started with the thread option of /chat.
+type Threads struct {
+	// AutoArchive is the inactivity period in minutes: 60, 1440, 4320 or 10080.
+	AutoArchive int `yaml:"autoArchive" env-default:"1440"`
+}
+
+// Storage configures the database that keeps conversations, settings and the request log.
+type Storage struct {
+	// Path of the database file, nothing is persisted when empty.
+	Path string `yaml:"path"`
+	// RequestRetention is how long the request log is kept, zero keeps it forever.
+	RequestRetention time.Duration `yaml:"requestRetention"`
+}
+
+// Shutdown controls how running chats are drained when the bot stops.
+type Shutdown struct {
+	// Timeout is how long running chats may take before they are cancelled,
+	// zero cancels them right away.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Commands controls how slash commands are registered.
+type Commands struct {
+	// DevGuild registers the commands in this guild only, where changes show up
+	// instantly. Global commands can take a while to update in clients.
+	// Global commands are kept, the commands of a previous dev guild are removed.
+	DevGuild string `yaml:"devGuild" env:"DISAI_DEV_GUILD"`
+}
+
+// Limits restricts how often and how much the bot can be used.
+// A role limit takes precedence over a guild limit, which takes precedence over Default.
+// With several matching roles the most generous limit applies.
+type Limits struct {
+	Default Limit            `yaml:"default"`
+	Guilds  map[string]Limit `yaml:"guilds"`
+	Roles   map[string]Limit `yaml:"roles"`
+	// GuildTotal limits all users of a guild together.
+	GuildTotal Limit `yaml:"guildTotal"`
+	// Exempt users, guilds, channels and roles are never limited.
+	Exempt AccessList `yaml:"exempt"`
+}
+
+// Limit is a token bucket of Rate requests refilled every Period plus daily quotas
+// reset at midnight UTC. Zero values disable the corresponding limit.
+type Limit struct {
+	Rate          int           `yaml:"rate"`
+	Period        time.Duration `yaml:"period"`
+	DailyRequests int           `yaml:"dailyRequests"`
+	DailyTokens   int           `yaml:"dailyTokens"`
+}
+
+// Usage controls how token usage is shown.
+type Usage struct {
+	// TokensPerSecond shows the output speed of the model next to the response time.
+	TokensPerSecond bool `yaml:"tokensPerSecond"`
+}
+
+// Metrics configures the Prometheus endpoint.
+type Metrics struct {
+	// Listen is the address of the /metrics listener, e.g. ":9090". Disabled when empty.
+	Listen string `yaml:"listen" env:"DISAI_METRICS_LISTEN"`
+}
+
+// Tracing configures the OpenTelemetry trace exporter.
+type Tracing struct {
+	// Exporter is "otlp" or "file", tracing is disabled when empty.
+	Exporter string `yaml:"exporter" env:"DISAI_TRACING_EXPORTER"`
+	// Endpoint is the OTLP/HTTP URL, e.g. "http://localhost:4318/v1/traces".
+	// The OTEL_EXPORTER_OTLP_* variables are used when empty.
+	Endpoint string `yaml:"endpoint"`
+	// File receives the spans as JSON lines with the file exporter.
+	File        string `yaml:"file" env-default:"./traces.json"`
+	ServiceName string `yaml:"serviceName" env-default:"disai"`
+	// SampleRatio is the share of traced chats, zero traces none.
+	SampleRatio float64 `yaml:"sampleRatio"`
+}
+
 type Templates struct {
 	System string `yaml:"system"`
 	User   string `yaml:"user"`
 }
 
-func NewConfig(path string) Config {
-	var cfg Config
-	err := cleanenv.ReadConfig(path, &cfg)
+// ModelProfiles returns the configured profiles and the name of the default one.
+// Profiles without templates use the global templates.
+func (c Config) ModelProfiles() (map[string]Profile, string) {
+	if len(c.Profiles) == 0 {
+		return map[string]Profile{
+			"default": {Model: c.Model, Generation: c.Generation, Templates: c.Templates},
+		}, "default"
+	}
+	profiles := make(map[string]Profile, len(c.Profiles))
+	names := make([]string, 0, len(c.Profiles))
+	for name, p := range c.Profiles {
+		if p.Templates.System == "" {
+			p.Templates.System = c.Templates.System
+		}
+		if p.Templates.User == "" {
+			p.Templates.User = c.Templates.User
+		}
+		p.Generation = p.Generation.Or(c.Generation)
+		profiles[name] = p
+		names = append(names, name)
+	}
+	def := c.DefaultProfile
+	if _, ok := profiles[def]; !ok {
+		sort.Strings(names)
+		def = names[0]
+	}
+	return profiles, def
+}
+
+// NewConfig reads the config file and the environment and validates the result.
+func NewConfig(path string) (Config, error) {
+	cfg, err := read(path)
+	if err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// NewLocalConfig is NewConfig for terminal commands, Discord settings are not required.
+func NewLocalConfig(path string) (Config, error) {
+	cfg, err := read(path)
 	if err != nil {
-		panic(err)
+		return Config{}, err
+	}
+	if err := cfg.ValidateLocal(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// defaults returns the defaults of settings whose zero value means something.
+// They are set before the file is read, because cleanenv replaces every zero
+// value with its env-default, including a zero written in the file.
+func defaults() Config {
+	return Config{
+		Balancing: Balancing{HealthInterval: 30 * time.Second, RequestTimeout: 5 * time.Minute, Retries: 2},
+		Queue:     Queue{Concurrency: 1, MaxPerUser: 2, MaxSize: 50},
+		Memory:    Memory{MaxTurns: 10, MaxTokens: 4000, TTL: time.Hour},
+		Images:    Images{MaxSize: 10 << 20, MaxCount: 4},
+		Streaming: Streaming{Enabled: true, EditInterval: 1500 * time.Millisecond},
+		Mentions:  Mentions{MaxReplyDepth: 10},
+		Shutdown:  Shutdown{Timeout: 30 * time.Second},
+		Storage:   Storage{Path: "./disai.db", RequestRetention: 720 * time.Hour},
+		Tracing:   Tracing{SampleRatio: 1},
+	}
+}
+
+func read(path string) (Config, error) {
+	cfg := defaults()
+	if err := cleanenv.ReadConfig(path, &cfg); err != nil {
+		return Config{}, fmt.Errorf("unable to read config %s: %w", path, err)
 	}
-	return cfg
+	return cfg, nil
 }
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadDefaults(t *testing.T) {
+	cfg, err := read(writeConfig(t, "model: m\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Storage.Path != "./disai.db" || cfg.Storage.RequestRetention != 720*time.Hour {
+		t.Errorf("storage defaults not applied: %+v", cfg.Storage)
+	}
+	if cfg.Memory != (Memory{MaxTurns: 10, MaxTokens: 4000, TTL: time.Hour}) {
+		t.Errorf("memory defaults not applied: %+v", cfg.Memory)
+	}
+	if cfg.Tracing.SampleRatio != 1 {
+		t.Errorf("sample ratio %v, want 1", cfg.Tracing.SampleRatio)
+	}
+	if cfg.Mentions.Any() {
+		t.Error("mentions are enabled by default, they need a privileged intent")
+	}
+	if !cfg.Streaming.Enabled {
+		t.Error("streaming is disabled by default")
+	}
+}
+
+// Zero values written in the file must not be replaced by the defaults.
+func TestReadKeepsExplicitZeros(t *testing.T) {
+	tests := []struct {
+		name  string
+		yaml  string
+		check func(cfg Config) bool
+	}{
+		{
+			name: "in-memory storage kept forever",
+			yaml: "storage:\n  path: \"\"\n  requestRetention: \"0s\"\n",
+			check: func(cfg Config) bool {
+				return cfg.Storage.Path == "" && cfg.Storage.RequestRetention == 0
+			},
+		},
+		{
+			name: "no health checks, timeouts or retries",
+			yaml: "balancing:\n  healthInterval: \"0s\"\n  requestTimeout: \"0s\"\n  retries: 0\n",
+			check: func(cfg Config) bool {
+				b := cfg.Balancing
+				return b.HealthInterval == 0 && b.RequestTimeout == 0 && b.Retries == 0
+			},
+		},
+		{
+			name: "unlimited queue",
+			yaml: "queue:\n  concurrency: 0\n  maxPerUser: 0\n  maxSize: 0\n",
+			check: func(cfg Config) bool {
+				q := cfg.Queue
+				return q.Concurrency == 0 && q.MaxPerUser == 0 && q.MaxSize == 0
+			},
+		},
+		{
+			name:  "streaming disabled",
+			yaml:  "streaming:\n  enabled: false\n",
+			check: func(cfg Config) bool { return !cfg.Streaming.Enabled },
+		},
+		{
+			name:  "no sampled traces",
+			yaml:  "tracing:\n  sampleRatio: 0\n",
+			check: func(cfg Config) bool { return cfg.Tracing.SampleRatio == 0 },
+		},
+		{
+			name: "no edits, reply context, image limits or shutdown wait",
+			yaml: "streaming:\n  editInterval: \"0s\"\nmentions:\n  maxReplyDepth: 0\nimages:\n  maxSize: 0\n  maxCount: 0\nshutdown:\n  timeout: \"0s\"\n",
+			check: func(cfg Config) bool {
+				return cfg.Streaming.EditInterval == 0 && cfg.Mentions.MaxReplyDepth == 0 &&
+					cfg.Images == (Images{}) && cfg.Shutdown.Timeout == 0
+			},
+		},
+		{
+			name:  "unlimited memory",
+			yaml:  "memory:\n  maxTurns: 0\n  maxTokens: 0\n  ttl: \"0s\"\n",
+			check: func(cfg Config) bool { return cfg.Memory == Memory{} },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := read(writeConfig(t, tt.yaml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(cfg) {
+				t.Errorf("zero values were replaced: %+v", cfg)
+			}
+		})
+	}
+}
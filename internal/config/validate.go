@@ -0,0 +1,213 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// ValidationError lists every problem found in the config.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid config:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the config and reports all problems at once.
+// The returned error is a *ValidationError.
+func (c Config) Validate() error {
+	return c.validate(true)
+}
+
+// ValidateLocal is Validate without the Discord settings, for running the model from the terminal.
+func (c Config) ValidateLocal() error {
+	return c.validate(false)
+}
+
+func (c Config) validate(discord bool) error {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if discord && c.Token == "" {
+		add("token: missing, set it in the config or with DISCORD_TOKEN")
+	}
+
+	if len(c.OllamaServers) == 0 {
+		add("ollamaServers: at least one server is required, e.g. local: \"http://localhost:11434\"")
+	}
+	for _, name := range sortedKeys(c.OllamaServers) {
+		if err := checkURL(c.OllamaServers[name]); err != nil {
+			add("ollamaServers.%s: %v", name, err)
+		}
+	}
+	for _, name := range sortedKeys(c.Queue.Servers) {
+		if _, ok := c.OllamaServers[name]; !ok {
+			add("queue.servers.%s: there is no such server in ollamaServers", name)
+		}
+	}
+	if s := c.Balancing.Strategy; s != "round-robin" && s != "least-busy" {
+		add("balancing.strategy: %q is unknown, use round-robin or least-busy", s)
+	}
+
+	for _, name := range sortedKeys(c.MCPServers) {
+		srv := c.MCPServers[name]
+		switch {
+		case srv.URL != "" && srv.Command != "":
+			add("mcpServers.%s: set either url or command, not both", name)
+		case srv.URL == "" && srv.Command == "":
+			add("mcpServers.%s: set url for an HTTP server or command for a stdio server", name)
+		case srv.URL != "":
+			if err := checkURL(srv.URL); err != nil {
+				add("mcpServers.%s.url: %v", name, err)
+			}
+		}
+	}
+
+	if len(c.Profiles) == 0 && c.Model == "" {
+		add("model: missing, set a model name like \"qwen3:8b\" or configure profiles")
+	}
+	if c.DefaultProfile != "" && len(c.Profiles) > 0 {
+		if _, ok := c.Profiles[c.DefaultProfile]; !ok {
+			add("defaultProfile: there is no profile named %q", c.DefaultProfile)
+		}
+	}
+	for _, name := range sortedKeys(c.Profiles) {
+		if c.Profiles[name].Model == "" {
+			add("profiles.%s.model: missing", name)
+		}
+	}
+
+	// Templates are checked once even when several profiles share them
+	profiles, _ := c.ModelProfiles()
+	checked := make(map[string]bool)
+	for _, name := range sortedKeys(profiles) {
+		p := profiles[name]
+		for _, t := range []struct{ kind, path string }{{"system", p.Templates.System}, {"user", p.Templates.User}} {
+			if t.path != "" && checked[t.path] {
+				continue
+			}
+			checked[t.path] = true
+			if err := checkTemplate(t.path); err != nil {
+				add("templates.%s (profile %s): %v", t.kind, name, err)
+			}
+		}
+	}
+
+	for _, name := range c.ChatOverrides {
+		if !slices.Contains(ChatOverrideNames, name) {
+			add("chatOverrides: %q is unknown, use %s", name, strings.Join(ChatOverrideNames, ", "))
+		}
+	}
+
+	// Two tools with the same display name can not be told apart in the status
+	byName := make(map[string][]string)
+	for tool, display := range c.ToolNames {
+		byName[display] = append(byName[display], tool)
+	}
+	for _, display := range sortedKeys(byName) {
+		if tools := byName[display]; len(tools) > 1 {
+			sort.Strings(tools)
+			add("toolNames: %q is used by %s", display, strings.Join(tools, ", "))
+		}
+	}
+
+	if discord && !slices.Contains([]int{60, 1440, 4320, 10080}, c.Threads.AutoArchive) {
+		add("threads.autoArchive: %d is not allowed, use 60, 1440, 4320 or 10080", c.Threads.AutoArchive)
+	}
+
+	switch c.Tracing.Exporter {
+	case "", "otlp":
+	case "file":
+		if c.Tracing.File == "" {
+			add("tracing.file: missing, the file exporter needs a path")
+		}
+	default:
+		add("tracing.exporter: unknown exporter %q, use otlp or file", c.Tracing.Exporter)
+	}
+	if c.Tracing.Exporter == "otlp" && c.Tracing.Endpoint != "" {
+		if err := checkURL(c.Tracing.Endpoint); err != nil {
+			add("tracing.endpoint: %v", err)
+		}
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		add("tracing.sampleRatio: %v is not between 0 and 1", c.Tracing.SampleRatio)
+	}
+
+	limits := map[string]Limit{"limits.default": c.Limits.Default, "limits.guildTotal": c.Limits.GuildTotal}
+	for id, l := range c.Limits.Guilds {
+		limits["limits.guilds."+id] = l
+	}
+	for id, l := range c.Limits.Roles {
+		limits["limits.roles."+id] = l
+	}
+	for _, name := range sortedKeys(limits) {
+		if err := checkLimit(limits[name]); err != nil {
+			add("%s: %v", name, err)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func checkURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("malformed URL %q: %w", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("URL %q must start with http:// or https://", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("URL %q has no host", raw)
+	}
+	return nil
+}
+
+func checkLimit(l Limit) error {
+	switch {
+	case l.Rate < 0 || l.Period < 0 || l.DailyRequests < 0 || l.DailyTokens < 0:
+		return errors.New("values must not be negative")
+	case l.Rate > 0 && l.Period == 0:
+		return errors.New("rate is set without a period")
+	case l.Period > 0 && l.Rate == 0:
+		return errors.New("period is set without a rate")
+	}
+	return nil
+}
+
+func checkTemplate(path string) error {
+	if path == "" {
+		return errors.New("missing file path")
+	}
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("file %s does not exist", path)
+		}
+		return err
+	}
+	if _, err := template.ParseFiles(path); err != nil {
+		return err
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
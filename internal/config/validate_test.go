@@ -0,0 +1,197 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validConfig returns a config that passes Validate, with templates in a temp dir.
+func validConfig(t *testing.T) Config {
+	t.Helper()
+	dir := t.TempDir()
+	system := filepath.Join(dir, "system.tmpl")
+	user := filepath.Join(dir, "user.tmpl")
+	for path, content := range map[string]string{system: "You are a bot", user: "{{.Message}}"} {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := defaults()
+	cfg.Token = "token"
+	cfg.Model = "qwen3:8b"
+	cfg.OllamaServers = map[string]string{"local": "http://localhost:11434"}
+	cfg.Balancing.Strategy = "round-robin"
+	cfg.Templates = Templates{System: system, User: user}
+	cfg.Threads.AutoArchive = 1440
+	cfg.Tracing.SampleRatio = 1
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(cfg *Config)
+		want   []string
+	}{
+		{
+			name:   "valid",
+			change: func(cfg *Config) {},
+		},
+		{
+			name:   "missing token",
+			change: func(cfg *Config) { cfg.Token = "" },
+			want:   []string{"token: missing"},
+		},
+		{
+			name:   "no ollama servers",
+			change: func(cfg *Config) { cfg.OllamaServers = nil },
+			want:   []string{"ollamaServers: at least one server"},
+		},
+		{
+			name: "bad server URLs",
+			change: func(cfg *Config) {
+				cfg.OllamaServers["nohost"] = "http://"
+				cfg.OllamaServers["scheme"] = "localhost:11434"
+			},
+			want: []string{"ollamaServers.nohost: URL \"http://\" has no host", "ollamaServers.scheme: URL \"localhost:11434\" must start with http://"},
+		},
+		{
+			name:   "queue limit for an unknown server",
+			change: func(cfg *Config) { cfg.Queue.Servers = map[string]int{"remote": 2} },
+			want:   []string{"queue.servers.remote: there is no such server"},
+		},
+		{
+			name:   "unknown strategy",
+			change: func(cfg *Config) { cfg.Balancing.Strategy = "random" },
+			want:   []string{"balancing.strategy: \"random\" is unknown"},
+		},
+		{
+			name: "mcp servers",
+			change: func(cfg *Config) {
+				cfg.MCPServers = map[string]MCPServer{
+					"both":    {URL: "http://localhost:8080", Command: "tool"},
+					"neither": {},
+					"url":     {URL: "ftp://localhost"},
+					"stdio":   {Command: "tool"},
+				}
+			},
+			want: []string{"mcpServers.both: set either url or command", "mcpServers.neither: set url", "mcpServers.url.url: URL \"ftp://localhost\" must start"},
+		},
+		{
+			name:   "missing model",
+			change: func(cfg *Config) { cfg.Model = "" },
+			want:   []string{"model: missing"},
+		},
+		{
+			name: "profiles",
+			change: func(cfg *Config) {
+				cfg.Profiles = map[string]Profile{"chat": {Model: "m"}, "empty": {}}
+				cfg.DefaultProfile = "coder"
+			},
+			want: []string{"defaultProfile: there is no profile named \"coder\"", "profiles.empty.model: missing"},
+		},
+		{
+			name:   "missing template",
+			change: func(cfg *Config) { cfg.Templates.User = filepath.Join(t.TempDir(), "missing.tmpl") },
+			want:   []string{"templates.user (profile default): file"},
+		},
+		{
+			name: "broken template",
+			change: func(cfg *Config) {
+				path := filepath.Join(t.TempDir(), "broken.tmpl")
+				if err := os.WriteFile(path, []byte("{{.Message"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				cfg.Templates.System = path
+			},
+			want: []string{"templates.system (profile default):"},
+		},
+		{
+			name:   "unknown chat override",
+			change: func(cfg *Config) { cfg.ChatOverrides = []string{"temperature", "topP"} },
+			want:   []string{"chatOverrides: \"topP\" is unknown, use temperature, top_p"},
+		},
+		{
+			name:   "duplicate tool names",
+			change: func(cfg *Config) { cfg.ToolNames = map[string]string{"get_weather": "Weather", "forecast": "Weather"} },
+			want:   []string{"toolNames: \"Weather\" is used by forecast, get_weather"},
+		},
+		{
+			name:   "auto archive",
+			change: func(cfg *Config) { cfg.Threads.AutoArchive = 30 },
+			want:   []string{"threads.autoArchive: 30 is not allowed"},
+		},
+		{
+			name: "limits",
+			change: func(cfg *Config) {
+				cfg.Limits.Default = Limit{Rate: 5}
+				cfg.Limits.GuildTotal = Limit{Period: time.Minute}
+				cfg.Limits.Roles = map[string]Limit{"1": {DailyTokens: -1}}
+			},
+			want: []string{"limits.default: rate is set without a period", "limits.guildTotal: period is set without a rate", "limits.roles.1: values must not be negative"},
+		},
+		{
+			name: "file exporter without a path",
+			change: func(cfg *Config) {
+				cfg.Tracing.Exporter = "file"
+				cfg.Tracing.File = ""
+			},
+			want: []string{"tracing.file: missing"},
+		},
+		{
+			name: "tracing",
+			change: func(cfg *Config) {
+				cfg.Tracing.Exporter = "otlp"
+				cfg.Tracing.Endpoint = "localhost:4318"
+				cfg.Tracing.SampleRatio = 2
+			},
+			want: []string{"tracing.endpoint: URL \"localhost:4318\" must start", "tracing.sampleRatio: 2 is not between 0 and 1"},
+		},
+		{
+			name:   "unknown exporter",
+			change: func(cfg *Config) { cfg.Tracing.Exporter = "jaeger" },
+			want:   []string{"tracing.exporter: unknown exporter \"jaeger\""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig(t)
+			tt.change(&cfg)
+			err := cfg.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("got %v, want a *ValidationError", err)
+			}
+			if len(verr.Problems) != len(tt.want) {
+				t.Fatalf("got problems %q, want %d", verr.Problems, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.HasPrefix(verr.Problems[i], want) {
+					t.Errorf("problem %d = %q, want prefix %q", i, verr.Problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateLocal(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.Token = ""
+	cfg.Threads.AutoArchive = 0
+	if err := cfg.ValidateLocal(); err != nil {
+		t.Errorf("local validation checks discord settings: %v", err)
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("missing token and auto archive passed validation")
+	}
+}
@@ -0,0 +1,177 @@
+package conversation
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+
+	"github.com/FlameInTheDark/disai/internal/config"
+	"github.com/FlameInTheDark/disai/internal/storage"
+)
+
+// charsPerToken is a rough estimate used to keep history under the token budget
+// without running a real tokenizer.
+const charsPerToken = 4
+
+// Store keeps conversation history keyed by channel or thread ID.
+type Store struct {
+	// mu serializes read-modify-write cycles of Append
+	mu        sync.Mutex
+	st        storage.Store
+	maxTurns  int
+	maxTokens int
+	ttl       time.Duration
+}
+
+// NewStore creates a conversation store with the configured limits on top of the storage.
+func NewStore(cfg config.Memory, st storage.Store) *Store {
+	return &Store{
+		st:        st,
+		maxTurns:  cfg.MaxTurns,
+		maxTokens: cfg.MaxTokens,
+		ttl:       cfg.TTL,
+	}
+}
+
+// History returns the stored messages for the key.
+func (s *Store) History(key string) []*ai.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(key)
+}
+
+// load returns the messages of the key, expired conversations are removed.
+func (s *Store) load(key string) []*ai.Message {
+	c, err := s.st.Conversation(key)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			slog.Error("Unable to load conversation", slog.String("key", key), slog.String("error", err.Error()))
+		}
+		return nil
+	}
+	if s.ttl > 0 && time.Since(c.Updated) > s.ttl {
+		s.delete(key)
+		return nil
+	}
+	return c.Messages
+}
+
+// Append adds messages to the history of the key and trims it to the configured budget.
+func (s *Store) Append(key string, messages ...*ai.Message) {
+	if len(messages) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := &storage.Conversation{
+		Messages: s.trim(append(s.load(key), messages...)),
+		Updated:  time.Now(),
+	}
+	if err := s.st.SaveConversation(key, c); err != nil {
+		slog.Error("Unable to save conversation", slog.String("key", key), slog.String("error", err.Error()))
+	}
+}
+
+// ReplaceTail replaces the messages at the end of the history of the key with new ones,
+// e.g. a regenerated answer takes the place of the old one. When the history does not
+// end with old anymore the history is kept and false is returned.
+func (s *Store) ReplaceTail(key string, old []*ai.Message, messages ...*ai.Message) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	history := s.load(key)
+	if len(old) == 0 || len(history) < len(old) || !sameMessages(history[len(history)-len(old):], old) {
+		return false
+	}
+	c := &storage.Conversation{
+		Messages: s.trim(append(history[:len(history)-len(old):len(history)-len(old)], messages...)),
+		Updated:  time.Now(),
+	}
+	if err := s.st.SaveConversation(key, c); err != nil {
+		slog.Error("Unable to save conversation", slog.String("key", key), slog.String("error", err.Error()))
+	}
+	return true
+}
+
+// Reset removes the history of the key.
+func (s *Store) Reset(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delete(key)
+}
+
+func (s *Store) delete(key string) {
+	if err := s.st.DeleteConversation(key); err != nil {
+		slog.Error("Unable to delete conversation", slog.String("key", key), slog.String("error", err.Error()))
+	}
+}
+
+// trim drops the oldest turns until the history fits into the turn and token budget.
+// A turn starts with a user message, so tool requests are never separated from their responses.
+func (s *Store) trim(messages []*ai.Message) []*ai.Message {
+	turns := splitTurns(messages)
+	if s.maxTurns > 0 && len(turns) > s.maxTurns {
+		turns = turns[len(turns)-s.maxTurns:]
+	}
+	if s.maxTokens > 0 {
+		total := 0
+		for _, t := range turns {
+			total += estimateTokens(t)
+		}
+		for len(turns) > 0 && total > s.maxTokens {
+			total -= estimateTokens(turns[0])
+			turns = turns[1:]
+		}
+	}
+	var out []*ai.Message
+	for _, t := range turns {
+		out = append(out, t...)
+	}
+	return out
+}
+
+func splitTurns(messages []*ai.Message) [][]*ai.Message {
+	var turns [][]*ai.Message
+	for _, msg := range messages {
+		if msg.Role == ai.RoleUser || len(turns) == 0 {
+			turns = append(turns, nil)
+		}
+		turns[len(turns)-1] = append(turns[len(turns)-1], msg)
+	}
+	return turns
+}
+
+// sameMessages compares messages by their encoded form, stored messages are decoded copies.
+func sameMessages(a, b []*ai.Message) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		x, errX := json.Marshal(a[i])
+		y, errY := json.Marshal(b[i])
+		if errX != nil || errY != nil || string(x) != string(y) {
+			return false
+		}
+	}
+	return true
+}
+
+func estimateTokens(messages []*ai.Message) int {
+	chars := 0
+	for _, msg := range messages {
+		for _, part := range msg.Content {
+			switch {
+			case part.IsText():
+				chars += len(part.Text)
+			case part.IsToolRequest(), part.IsToolResponse():
+				if data, err := json.Marshal(part); err == nil {
+					chars += len(data)
+				}
+			}
+		}
+	}
+	return chars / charsPerToken
+}
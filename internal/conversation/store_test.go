@@ -0,0 +1,140 @@
+package conversation
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+
+	"github.com/FlameInTheDark/disai/internal/config"
+	"github.com/FlameInTheDark/disai/internal/storage"
+)
+
+func turn(user, answer string) []*ai.Message {
+	return []*ai.Message{ai.NewUserTextMessage(user), ai.NewModelTextMessage(answer)}
+}
+
+func toolTurn(user string) []*ai.Message {
+	return []*ai.Message{
+		ai.NewUserTextMessage(user),
+		ai.NewModelMessage(ai.NewToolRequestPart(&ai.ToolRequest{Name: "search", Input: map[string]any{"q": user}})),
+		ai.NewMessage(ai.RoleTool, nil, ai.NewToolResponsePart(&ai.ToolResponse{Name: "search", Output: "result"})),
+		ai.NewModelTextMessage("answer"),
+	}
+}
+
+func texts(messages []*ai.Message) []string {
+	var out []string
+	for _, msg := range messages {
+		if msg.Role == ai.RoleUser {
+			out = append(out, msg.Text())
+		}
+	}
+	return out
+}
+
+func TestTrim(t *testing.T) {
+	long := strings.Repeat("x", 400) // about 100 tokens
+	tests := []struct {
+		name      string
+		cfg       config.Memory
+		messages  [][]*ai.Message
+		wantUsers []string
+	}{
+		{
+			name:      "no limits",
+			messages:  [][]*ai.Message{turn("1", "a"), turn("2", "b")},
+			wantUsers: []string{"1", "2"},
+		},
+		{
+			name:      "turn limit keeps the newest turns",
+			cfg:       config.Memory{MaxTurns: 2},
+			messages:  [][]*ai.Message{turn("1", "a"), turn("2", "b"), turn("3", "c")},
+			wantUsers: []string{"2", "3"},
+		},
+		{
+			name:      "token limit",
+			cfg:       config.Memory{MaxTokens: 150},
+			messages:  [][]*ai.Message{turn("1", long), turn("2", long)},
+			wantUsers: []string{"2"},
+		},
+		{
+			name:      "a single turn over the token budget is dropped",
+			cfg:       config.Memory{MaxTokens: 10},
+			messages:  [][]*ai.Message{turn("1", long)},
+			wantUsers: nil,
+		},
+		{
+			name:      "tool calls stay with their turn",
+			cfg:       config.Memory{MaxTurns: 1},
+			messages:  [][]*ai.Message{turn("1", "a"), toolTurn("2")},
+			wantUsers: []string{"2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStore(tt.cfg, storage.NewMemory())
+			var messages []*ai.Message
+			for _, m := range tt.messages {
+				messages = append(messages, m...)
+			}
+			got := s.trim(messages)
+			if users := texts(got); strings.Join(users, ",") != strings.Join(tt.wantUsers, ",") {
+				t.Errorf("kept turns %v, want %v", users, tt.wantUsers)
+			}
+			if len(got) > 0 && got[0].Role != ai.RoleUser {
+				t.Errorf("history starts with a %s message", got[0].Role)
+			}
+		})
+	}
+}
+
+func TestTrimKeepsToolMessages(t *testing.T) {
+	s := NewStore(config.Memory{MaxTurns: 1}, storage.NewMemory())
+	got := s.trim(append(turn("1", "a"), toolTurn("2")...))
+	if len(got) != 4 {
+		t.Fatalf("got %d messages, want the 4 messages of the tool turn", len(got))
+	}
+}
+
+func TestStoreExpires(t *testing.T) {
+	st := storage.NewMemory()
+	s := NewStore(config.Memory{TTL: time.Hour}, st)
+	s.Append("c", turn("1", "a")...)
+	if got := len(s.History("c")); got != 2 {
+		t.Fatalf("got %d messages, want 2", got)
+	}
+	if err := st.SaveConversation("c", &storage.Conversation{Messages: turn("1", "a"), Updated: time.Now().Add(-2 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.History("c"); got != nil {
+		t.Errorf("expired conversation returned %d messages", len(got))
+	}
+}
+
+func TestReplaceTail(t *testing.T) {
+	s := NewStore(config.Memory{}, storage.NewMemory())
+	first, answer := turn("1", "a"), turn("2", "b")
+	s.Append("c", append(first, answer...)...)
+
+	if !s.ReplaceTail("c", answer, turn("2", "regenerated")...) {
+		t.Fatal("the last turn was not replaced")
+	}
+	got := s.History("c")
+	if len(got) != 4 || got[3].Text() != "regenerated" {
+		t.Fatalf("got %d messages ending with %q", len(got), got[len(got)-1].Text())
+	}
+
+	// A later turn keeps the old answer from being replaced
+	s.Append("c", turn("3", "c")...)
+	if s.ReplaceTail("c", turn("2", "regenerated"), turn("2", "again")...) {
+		t.Error("an answer that is not the last turn was replaced")
+	}
+	if users := texts(s.History("c")); strings.Join(users, ",") != "1,2,3" {
+		t.Errorf("history changed to %v", users)
+	}
+	if s.ReplaceTail("c", nil, turn("4", "d")...) {
+		t.Error("nothing to replace reported a replacement")
+	}
+}
@@ -2,12 +2,16 @@ package mcp
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/firebase/genkit/go/ai"
 	"github.com/firebase/genkit/go/genkit"
 	gmcp "github.com/firebase/genkit/go/plugins/mcp"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/FlameInTheDark/disai/internal/config"
+	"github.com/FlameInTheDark/disai/internal/tracing"
 )
 
 // Client wraps a Genkit MCP manager for interacting with MCP servers.
@@ -17,7 +21,7 @@ type Client struct {
 }
 
 // NewClient creates MCP clients for all provided servers using the configured transport.
-func NewClient(servers map[string]config.MCPServer) *Client {
+func NewClient(servers map[string]config.MCPServer) (*Client, error) {
 	var cls []*gmcp.GenkitMCPClient
 	for name, srv := range servers {
 		opts := gmcp.MCPClientOptions{Name: name}
@@ -31,16 +35,31 @@ func NewClient(servers map[string]config.MCPServer) *Client {
 		}
 		cl, err := gmcp.NewGenkitMCPClient(opts)
 		if err != nil {
-			panic(err)
+			return nil, fmt.Errorf("mcp server %s: %w", name, err)
 		}
 		cls = append(cls, cl)
 	}
-	return &Client{clients: cls}
+	return &Client{clients: cls}, nil
+}
+
+// Close disconnects from all MCP servers and stops stdio server processes.
+func (c *Client) Close() error {
+	var errs []error
+	for _, cl := range c.clients {
+		if err := cl.Disconnect(); err != nil {
+			errs = append(errs, fmt.Errorf("mcp server %s: %w", cl.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // GetTools aggregates all active tools from connected MCP servers and returns them.
-func (c *Client) GetTools(ctx context.Context, g *genkit.Genkit) ([]ai.Tool, error) {
-	var tools []ai.Tool
+func (c *Client) GetTools(ctx context.Context, g *genkit.Genkit) (tools []ai.Tool, err error) {
+	ctx, span := tracing.Start(ctx, "mcp.GetTools", attribute.Int("mcp.servers", len(c.clients)))
+	defer func() {
+		span.SetAttributes(attribute.Int("mcp.tools", len(tools)))
+		tracing.End(span, err)
+	}()
 	for _, cl := range c.clients {
 		t, err := cl.GetActiveTools(ctx, g)
 		if err != nil {
@@ -0,0 +1,94 @@
+// Package metrics exposes Prometheus metrics of the bot and the models.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Phases of a model request.
+const (
+	PhaseTemplate   = "template"
+	PhaseTools      = "tools"
+	PhaseGeneration = "generation"
+)
+
+// registry holds the metrics of the bot. The collectors are always updated,
+// they are only exposed when the listener is enabled.
+var registry = prometheus.NewRegistry()
+
+var (
+	requests = mustRegister(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "disai_requests_total",
+		Help: "Requests by command and outcome.",
+	}, []string{"command", "outcome"}))
+	phases = mustRegister(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "disai_phase_duration_seconds",
+		Help:    "Duration of the phases of a model request.",
+		Buckets: []float64{0.005, 0.025, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"phase"}))
+	toolCalls = mustRegister(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "disai_tool_calls_total",
+		Help: "Tool calls by tool name.",
+	}, []string{"tool"}))
+	toolErrors = mustRegister(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "disai_tool_errors_total",
+		Help: "Failed tool calls by tool name.",
+	}, []string{"tool"}))
+)
+
+func mustRegister[C prometheus.Collector](c C) C {
+	registry.MustRegister(c)
+	return c
+}
+
+func init() {
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+}
+
+// Request counts a request of the command with its outcome.
+func Request(command, outcome string) {
+	requests.WithLabelValues(command, outcome).Inc()
+}
+
+// Phase records how long a phase of a model request took.
+func Phase(phase string, d time.Duration) {
+	phases.WithLabelValues(phase).Observe(d.Seconds())
+}
+
+// ToolCall counts a call of the tool, failed calls are counted separately too.
+func ToolCall(tool string, err error) {
+	toolCalls.WithLabelValues(tool).Inc()
+	if err != nil {
+		toolErrors.WithLabelValues(tool).Inc()
+	}
+}
+
+// Register adds collectors owned by other packages, like gauges read on scrape.
+func Register(cs ...prometheus.Collector) {
+	registry.MustRegister(cs...)
+}
+
+// Serve exposes /metrics on the address until the context is done.
+func Serve(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	slog.Info("Serving metrics", slog.String("addr", addr))
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Metrics listener failed", slog.String("error", err.Error()))
+	}
+}
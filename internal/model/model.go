@@ -2,13 +2,24 @@ package model
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
 	"strings"
-	"text/template"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/FlameInTheDark/disai/internal/config"
 	"github.com/FlameInTheDark/disai/internal/mcp"
+	"github.com/FlameInTheDark/disai/internal/metrics"
+	"github.com/FlameInTheDark/disai/internal/ollama"
+	"github.com/FlameInTheDark/disai/internal/tracing"
 	"github.com/firebase/genkit/go/ai"
 	"github.com/firebase/genkit/go/genkit"
-	"github.com/firebase/genkit/go/plugins/ollama"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const maxToolCalls = 10
@@ -16,45 +27,204 @@ const maxToolCalls = 10
 // StatusCallback is called to report the current status of the Chat operation.
 type StatusCallback func(status string)
 
+// Request describes a single chat turn.
+type Request struct {
+	// Profile is the name of the model profile, the default profile is used when empty or unknown.
+	Profile string
+	// User identifies the requester for the per-user queue limit.
+	User    string
+	Message string
+	Args    map[string]any
+	// History holds previous messages of the conversation without the system message.
+	History []*ai.Message
+	Status  StatusCallback
+	// Stream enables streaming, the callback receives answer and reasoning chunks separately.
+	Stream StreamCallback
+	// Images are attached to the user message, the model must support vision.
+	Images []Image
+	// Generation overrides the generation options of the profile.
+	Generation config.Generation
+}
+
+// Image is an image attached to a request.
+type Image struct {
+	ContentType string
+	Data        []byte
+}
+
+// ErrVisionUnsupported is returned when images are sent to a text-only model.
+var ErrVisionUnsupported = errors.New("this model does not support images")
+
+// Response holds the model answer and the messages produced during the turn.
+type Response struct {
+	// Text is the answer without reasoning blocks.
+	Text string
+	// Reasoning holds the reasoning of all model turns.
+	Reasoning string
+	// Messages contains the user message, tool calls and the final answer of the turn.
+	// Reasoning is stripped from them so it does not take space in the history.
+	Messages []*ai.Message
+	// Usage sums the tokens of all model turns.
+	Usage Usage
+}
+
 // Model wraps a Genkit instance and MCP manager to handle chat requests.
 type Model struct {
-	name      string
-	g         *genkit.Genkit
-	mcp       *mcp.Client
-	ToolNames map[string]string
+	g    *genkit.Genkit
+	pool *Pool
+	mcp  *mcp.Client
 
-	systemTpl *template.Template
-	userTpl   *template.Template
+	// state is swapped as a whole when the config is reloaded
+	state atomic.Pointer[state]
+	// defined holds the Ollama models already registered in Genkit
+	defined   map[string]bool
+	definedMu sync.Mutex
 }
 
-// NewModel initialises Genkit with the Ollama plugin and connects MCP servers.
-// Only the first Ollama server URL is used as Genkit's Ollama plugin supports a
-// single server.
-func NewModel(modelName string, servers map[string]string, mcpc *mcp.Client, system, user string, toolNames map[string]string) *Model {
-	var serverURL string
-	for _, url := range servers {
-		serverURL = url
-		break
-	}
+// state is the reloadable part of the model configuration.
+type state struct {
+	profiles       map[string]*Profile
+	defaultProfile string
+	toolNames      map[string]string
+}
+
+// NewModel initialises Genkit with the Ollama models of all profiles backed by the server pool.
+func NewModel(cfg config.Config, pool *Pool, mcpc *mcp.Client) (*Model, error) {
+	profiles, defaultProfile := cfg.ModelProfiles()
+
 	ctx := context.Background()
-	o := &ollama.Ollama{ServerAddress: serverURL}
-	g := genkit.Init(ctx, genkit.WithPlugins(o), genkit.WithDefaultModel("ollama/"+modelName))
-	o.DefineModel(g, ollama.ModelDefinition{Name: modelName, Type: "chat"}, &ai.ModelOptions{
-		Supports: &ai.ModelSupports{
-			Multiturn:  true,
-			SystemRole: true,
-			Tools:      true,
-		},
-	})
+	g := genkit.Init(ctx, genkit.WithDefaultModel("ollama/"+profiles[defaultProfile].Model))
 
 	m := &Model{
-		name:      modelName,
-		g:         g,
-		mcp:       mcpc,
-		ToolNames: toolNames,
+		g:       g,
+		pool:    pool,
+		mcp:     mcpc,
+		defined: make(map[string]bool),
+	}
+	if err := m.Reload(cfg); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Reload parses the profiles and templates of the config and swaps them in.
+// The previous configuration stays active when an error is returned.
+func (m *Model) Reload(cfg config.Config) error {
+	profiles, defaultProfile := cfg.ModelProfiles()
+	st := &state{
+		profiles:       make(map[string]*Profile, len(profiles)),
+		defaultProfile: defaultProfile,
+		toolNames:      cfg.ToolNames,
+	}
+	for name, p := range profiles {
+		profile, err := newProfile(name, p, cfg.ModelCapabilities[p.Model])
+		if err != nil {
+			return err
+		}
+		st.profiles[name] = profile
+	}
+
+	// Profiles may share a model, define every model once. Vision is checked
+	// per profile in Generate, so a model can be marked as vision later on.
+	m.definedMu.Lock()
+	for _, p := range st.profiles {
+		if m.defined[p.ModelName] {
+			continue
+		}
+		m.defined[p.ModelName] = true
+		genkit.DefineModel(m.g, "ollama/"+p.ModelName, &ai.ModelOptions{
+			Label: "Ollama - " + p.ModelName,
+			Supports: &ai.ModelSupports{
+				Multiturn:  true,
+				SystemRole: true,
+				Tools:      true,
+				Media:      true,
+			},
+		}, m.generate(p.ModelName))
+	}
+	m.definedMu.Unlock()
+
+	m.state.Store(st)
+	return nil
+}
+
+// Profiles returns all profiles sorted by name.
+func (m *Model) Profiles() []*Profile {
+	st := m.state.Load()
+	out := make([]*Profile, 0, len(st.profiles))
+	for _, p := range st.profiles {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Profile returns the profile with the given name, or the default profile when it does not exist.
+func (m *Model) Profile(name string) *Profile {
+	st := m.state.Load()
+	if p, ok := st.profiles[name]; ok {
+		return p
+	}
+	return st.profiles[st.defaultProfile]
+}
+
+// HasProfile reports whether a profile with the given name exists.
+func (m *Model) HasProfile(name string) bool {
+	_, ok := m.state.Load().profiles[name]
+	return ok
+}
+
+// DefaultProfile returns the name of the default profile.
+func (m *Model) DefaultProfile() string {
+	return m.state.Load().defaultProfile
+}
+
+// SupportsImages reports whether the model of the profile accepts image attachments.
+func (m *Model) SupportsImages(profile string) bool {
+	return m.Profile(profile).Vision
+}
+
+// Close disconnects the MCP servers.
+func (m *Model) Close() error {
+	return m.mcp.Close()
+}
+
+// Tools returns the tools of all MCP servers.
+func (m *Model) Tools(ctx context.Context) ([]ai.Tool, error) {
+	return m.mcp.GetTools(ctx, m.g)
+}
+
+// ToolName returns the name of the tool shown in status updates.
+func (m *Model) ToolName(rawName string) string {
+	return displayName(m.state.Load().toolNames, rawName)
+}
+
+// generate returns the Genkit model function of an Ollama model. Every model turn
+// goes through the pool, so a failing server is replaced by another one in the
+// middle of a tool loop.
+func (m *Model) generate(modelName string) ai.ModelFunc {
+	return func(ctx context.Context, req *ai.ModelRequest, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+		chatReq, err := ollama.NewChatRequest(modelName, req)
+		if err != nil {
+			return nil, err
+		}
+		if gen, ok := req.Config.(*config.Generation); ok {
+			chatReq.Options = ollamaOptions(*gen)
+			chatReq.KeepAlive = gen.KeepAlive
+		}
+		var fn func(*ollama.ChatResponse) error
+		if cb != nil {
+			chatReq.Stream = true
+			fn = func(chunk *ollama.ChatResponse) error {
+				return cb(ctx, chunk.ModelResponseChunk())
+			}
+		}
+		resp, err := m.pool.Chat(ctx, chatReq, fn)
+		if err != nil {
+			return nil, err
+		}
+		return resp.ModelResponse(req), nil
 	}
-	m.LoadTemplate(system, user)
-	return m
 }
 
 // Chat sends a message to the model without status updates.
@@ -64,62 +234,88 @@ func (m *Model) Chat(ctx context.Context, message string, args map[string]any) (
 
 // ChatWithStatus generates a response using Genkit and reports progress via the callback.
 func (m *Model) ChatWithStatus(ctx context.Context, message string, args map[string]any, status StatusCallback) (string, error) {
+	resp, err := m.Generate(ctx, Request{Message: message, Args: args, Status: status})
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
+
+// Generate runs a chat turn on top of the conversation history and reports progress via the request callback.
+// When the generation fails the response is returned with the error and only carries the token usage.
+func (m *Model) Generate(ctx context.Context, req Request) (*Response, error) {
+	toolNames := m.state.Load().toolNames
+	profile := m.Profile(req.Profile)
+	if len(req.Images) > 0 && !profile.Vision {
+		return nil, ErrVisionUnsupported
+	}
+	status := req.Status
 	if status != nil {
 		status("📝 Preparing message templates...")
 	}
 
-	system, err := m.ExecuteSystemTemplate(args)
+	system, user, err := profile.executeTemplates(ctx, req.Message, req.Args)
 	if err != nil {
-		return "", err
-	}
-	user, err := m.ExecuteUserTemplate(message, args)
-	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if status != nil {
 		status("🔧 Loading tools...")
 	}
-	tools, err := m.mcp.GetTools(ctx, m.g)
+	start := time.Now()
+	all, err := m.mcp.GetTools(ctx, m.g)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	metrics.Phase(metrics.PhaseTools, time.Since(start))
+	var tools []ai.Tool
+	for _, t := range all {
+		if profile.allowsTool(t.Name()) {
+			tools = append(tools, t)
+		}
 	}
 
-	if status != nil {
-		wrapped := make([]ai.Tool, len(tools))
-		for i, t := range tools {
-			tool := t
-			def := t.Definition()
-			rawName := t.Name()
-			display := m.ToolNames[rawName]
-			if display == "" {
-				if parts := strings.SplitN(rawName, "_", 2); len(parts) == 2 {
-					display = m.ToolNames[parts[1]]
-				}
-				if display == "" {
-					if parts := strings.SplitN(rawName, "_", 2); len(parts) == 2 {
-						display = parts[1]
-					} else {
-						display = rawName
-					}
+	// Tools are wrapped to report their calls in the status and the metrics
+	wrapped := make([]ai.Tool, len(tools))
+	for i, t := range tools {
+		tool := t
+		def := t.Definition()
+		disp := displayName(toolNames, t.Name())
+
+		wrapped[i] = ai.NewToolWithInputSchema[any](
+			def.Name,
+			def.Description,
+			def.InputSchema,
+			func(tc *ai.ToolContext, input any) (any, error) {
+				if status != nil {
+					status(disp)
 				}
-			}
-			disp := display
-
-			wrapped[i] = ai.NewToolWithInputSchema[any](
-				def.Name,
-				def.Description,
-				def.InputSchema,
-				func(tc *ai.ToolContext, input any) (any, error) {
-					if status != nil {
-						status(disp)
-					}
-					return tool.RunRaw(tc.Context, input)
-				},
-			)
+				ctx, span := tracing.Start(tc.Context, "tool "+def.Name, attribute.String("tool.name", def.Name))
+				out, err := tool.RunRaw(ctx, input)
+				tracing.End(span, err)
+				metrics.ToolCall(def.Name, err)
+				return out, err
+			},
+		)
+	}
+	tools = wrapped
+
+	_, queueSpan := tracing.Start(ctx, "queue")
+	slot, err := m.pool.Acquire(ctx, req.User, func(position int) {
+		queueSpan.AddEvent("queued", trace.WithAttributes(attribute.Int("queue.position", position)))
+		if status != nil {
+			status(fmt.Sprintf("%s Waiting in queue: position %d", QueueStatusPrefix, position))
 		}
-		tools = wrapped
+	})
+	if slot != nil {
+		queueSpan.SetAttributes(attribute.String("ollama.backend", slot.Backend().Name))
 	}
+	tracing.End(queueSpan, err)
+	if err != nil {
+		return nil, err
+	}
+	defer slot.Release()
+	ctx = withSlot(ctx, slot)
 
 	if status != nil {
 		status("🤖 AI is thinking...")
@@ -130,21 +326,129 @@ func (m *Model) ChatWithStatus(ctx context.Context, message string, args map[str
 		refs[i] = t
 	}
 
-	resp, err := genkit.GenerateText(ctx, m.g,
-		ai.WithModelName("ollama/"+m.name),
-		ai.WithMessages(
-			ai.NewSystemTextMessage(system),
-			ai.NewUserTextMessage(user),
-		),
+	messages := make([]*ai.Message, 0, len(req.History)+2)
+	messages = append(messages, ai.NewSystemTextMessage(system))
+	messages = append(messages, req.History...)
+	userParts := []*ai.Part{ai.NewTextPart(user)}
+	for _, img := range req.Images {
+		userParts = append(userParts, ai.NewMediaPart(img.ContentType, dataURL(img)))
+	}
+	messages = append(messages, ai.NewUserMessage(userParts...))
+
+	gen := req.Generation.Or(profile.Generation)
+	usage := &usageCounter{}
+	opts := []ai.GenerateOption{
+		ai.WithModelName("ollama/" + profile.ModelName),
+		ai.WithConfig(&gen),
+		ai.WithMessages(messages...),
 		ai.WithTools(refs...),
 		ai.WithMaxTurns(maxToolCalls),
-	)
+		ai.WithMiddleware(traceTurns(profile.ModelName), usage.middleware),
+	}
+	var splitter *thinkSplitter
+	if req.Stream != nil {
+		splitter = &thinkSplitter{emit: req.Stream}
+		opts = append(opts, ai.WithStreaming(func(ctx context.Context, chunk *ai.ModelResponseChunk) error {
+			splitter.Write(chunk.Text())
+			return nil
+		}))
+	}
+
+	start = time.Now()
+	resp, err := genkit.Generate(ctx, m.g, opts...)
+	metrics.Phase(metrics.PhaseGeneration, time.Since(start))
+	if splitter != nil {
+		splitter.Flush()
+	}
 	if err != nil {
-		return "", err
+		// Turns that finished before the error were still paid for
+		return &Response{Usage: usage.get()}, err
 	}
 
 	if status != nil {
 		status("✨ Formatting response...")
 	}
-	return resp, nil
+
+	// Everything after the system message and the replayed history belongs to this turn.
+	out := &Response{Usage: usage.get()}
+	if history := resp.History(); len(history) > len(messages)-1 {
+		out.Messages = history[len(messages)-1:]
+	}
+	var thoughts []string
+	for i, msg := range out.Messages {
+		if msg.Role == ai.RoleUser {
+			out.Messages[i] = stripMedia(msg)
+			continue
+		}
+		if msg.Role != ai.RoleModel {
+			continue
+		}
+		reasoning, stripped := stripThinking(msg)
+		if reasoning != "" {
+			thoughts = append(thoughts, reasoning)
+		}
+		out.Messages[i] = stripped
+	}
+	out.Reasoning = strings.Join(thoughts, "\n\n")
+	_, out.Text = SplitThinking(resp.Text())
+	return out, nil
+}
+
+// displayName looks the tool up in toolNames by its full name, then by the name
+// without the MCP server prefix, and falls back to the name without the prefix.
+func displayName(toolNames map[string]string, rawName string) string {
+	if display := toolNames[rawName]; display != "" {
+		return display
+	}
+	if parts := strings.SplitN(rawName, "_", 2); len(parts) == 2 {
+		if display := toolNames[parts[1]]; display != "" {
+			return display
+		}
+		return parts[1]
+	}
+	return rawName
+}
+
+// stripMedia replaces images with a short note, so they are not sent again
+// with every following message of the conversation.
+func stripMedia(msg *ai.Message) *ai.Message {
+	parts := make([]*ai.Part, 0, len(msg.Content))
+	for _, part := range msg.Content {
+		if part.IsMedia() {
+			parts = append(parts, ai.NewTextPart("\n[image attached]"))
+			continue
+		}
+		parts = append(parts, part)
+	}
+	return ai.NewMessage(msg.Role, msg.Metadata, parts...)
+}
+
+func dataURL(img Image) string {
+	return "data:" + img.ContentType + ";base64," + base64.StdEncoding.EncodeToString(img.Data)
+}
+
+// stripThinking returns the reasoning of a model message and a copy of the
+// message without it.
+func stripThinking(msg *ai.Message) (string, *ai.Message) {
+	var (
+		thoughts []string
+		parts    []*ai.Part
+	)
+	for _, part := range msg.Content {
+		switch {
+		case part.IsReasoning():
+			thoughts = append(thoughts, part.Text)
+		case part.IsText():
+			reasoning, answer := SplitThinking(part.Text)
+			if reasoning != "" {
+				thoughts = append(thoughts, reasoning)
+			}
+			if answer != "" {
+				parts = append(parts, ai.NewTextPart(answer))
+			}
+		default:
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(thoughts, "\n\n"), ai.NewMessage(msg.Role, msg.Metadata, parts...)
 }
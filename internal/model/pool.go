@@ -0,0 +1,254 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/FlameInTheDark/disai/internal/config"
+	"github.com/FlameInTheDark/disai/internal/ollama"
+)
+
+const (
+	StrategyRoundRobin = "round-robin"
+	StrategyLeastBusy  = "least-busy"
+)
+
+// ErrNoBackends is returned when no Ollama server could serve the request.
+var ErrNoBackends = errors.New("no Ollama servers available")
+
+// Backend is a single Ollama server of the pool.
+type Backend struct {
+	Name   string
+	client *ollama.Client
+
+	healthy  atomic.Bool
+	inflight atomic.Int64
+
+	// limit is the number of jobs the backend runs at once, zero means unlimited.
+	// active is guarded by the pool mutex.
+	limit  int
+	active int
+}
+
+// URL returns the server address of the backend.
+func (b *Backend) URL() string {
+	return b.client.BaseURL()
+}
+
+// Healthy reports the result of the last health check or request.
+func (b *Backend) Healthy() bool {
+	return b.healthy.Load()
+}
+
+// InFlight returns the number of requests currently running on the backend.
+func (b *Backend) InFlight() int64 {
+	return b.inflight.Load()
+}
+
+func (b *Backend) free() bool {
+	return b.limit <= 0 || b.active < b.limit
+}
+
+// Pool balances chat requests across all configured Ollama servers and
+// retries failed requests on another server.
+type Pool struct {
+	backends []*Backend
+	strategy string
+	interval time.Duration
+	timeout  time.Duration
+	retries  int
+	next     atomic.Uint64
+
+	mu         sync.Mutex
+	waiting    []*waiter
+	perUser    map[string]int
+	maxPerUser int
+	maxSize    int
+}
+
+// NewPool creates a pool from the ollamaServers map. Backends are ordered by name,
+// so the order does not change between restarts.
+func NewPool(servers map[string]string, cfg config.Balancing, queue config.Queue) *Pool {
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	p := &Pool{
+		strategy: cfg.Strategy,
+		interval: cfg.HealthInterval,
+		timeout:  cfg.RequestTimeout,
+		retries:  cfg.Retries,
+
+		perUser:    make(map[string]int),
+		maxPerUser: queue.MaxPerUser,
+		maxSize:    queue.MaxSize,
+	}
+	for _, name := range names {
+		b := &Backend{Name: name, client: ollama.NewClient(servers[name]), limit: queue.Concurrency}
+		if limit, ok := queue.Servers[name]; ok {
+			b.limit = limit
+		}
+		// Assume healthy until the first check says otherwise
+		b.healthy.Store(true)
+		p.backends = append(p.backends, b)
+	}
+	return p
+}
+
+// Backends returns all backends of the pool.
+func (p *Pool) Backends() []*Backend {
+	return p.backends
+}
+
+// Run health-checks every backend until the context is cancelled.
+func (p *Pool) Run(ctx context.Context) {
+	p.checkAll(ctx)
+	if p.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.checkAll(ctx)
+		}
+	}
+}
+
+func (p *Pool) checkAll(ctx context.Context) {
+	for _, b := range p.backends {
+		checkCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err := b.client.Ping(checkCtx)
+		cancel()
+		p.setHealthy(b, err)
+	}
+}
+
+func (p *Pool) setHealthy(b *Backend, err error) {
+	healthy := err == nil
+	if b.healthy.Swap(healthy) != healthy {
+		if healthy {
+			slog.Info("Ollama server is up", slog.String("server", b.Name))
+		} else {
+			slog.Warn("Ollama server is down", slog.String("server", b.Name), slog.String("error", err.Error()))
+		}
+	}
+}
+
+// Chat sends the request to a backend chosen by the balancing strategy and
+// retries on another backend when it fails. Streamed requests are not retried
+// once the first chunk has been delivered. Requests of a queued job fail over
+// only to backends with a free slot and take the slot of the job along.
+func (p *Pool) Chat(ctx context.Context, req *ollama.ChatRequest, fn func(*ollama.ChatResponse) error) (*ollama.ChatResponse, error) {
+	tried := make(map[*Backend]bool)
+	var lastErr error
+	for attempt := 0; attempt <= p.retries; attempt++ {
+		var b *Backend
+		if slot := slotFromContext(ctx); slot != nil {
+			b = p.move(slot, tried)
+		} else {
+			b = p.pick(func(b *Backend) bool { return !tried[b] }, (*Backend).InFlight)
+		}
+		if b == nil {
+			break
+		}
+		tried[b] = true
+
+		streamed := false
+		var chunkFn func(*ollama.ChatResponse) error
+		if fn != nil {
+			chunkFn = func(chunk *ollama.ChatResponse) error {
+				streamed = true
+				return fn(chunk)
+			}
+		}
+
+		resp, err := p.chat(ctx, b, req, chunkFn)
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		lastErr = err
+		if unhealthy(err) {
+			p.setHealthy(b, err)
+		}
+		slog.Warn("Ollama request failed", slog.String("server", b.Name), slog.String("error", err.Error()))
+		if streamed {
+			return nil, err
+		}
+	}
+	if lastErr != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNoBackends, lastErr)
+	}
+	return nil, ErrNoBackends
+}
+
+func (p *Pool) chat(ctx context.Context, b *Backend, req *ollama.ChatRequest, fn func(*ollama.ChatResponse) error) (*ollama.ChatResponse, error) {
+	b.inflight.Add(1)
+	defer b.inflight.Add(-1)
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	return b.client.Chat(ctx, req, fn)
+}
+
+// pick chooses the next backend accepted by the filter. Healthy backends are
+// preferred, unhealthy ones are used only when nothing else is left. The load
+// function is used by the least-busy strategy.
+func (p *Pool) pick(filter func(*Backend) bool, load func(*Backend) int64) *Backend {
+	var healthy, rest []*Backend
+	for _, b := range p.backends {
+		if !filter(b) {
+			continue
+		}
+		if b.Healthy() {
+			healthy = append(healthy, b)
+		} else {
+			rest = append(rest, b)
+		}
+	}
+	candidates := healthy
+	if len(candidates) == 0 {
+		candidates = rest
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	if p.strategy == StrategyLeastBusy {
+		best := candidates[0]
+		for _, b := range candidates[1:] {
+			if load(b) < load(best) {
+				best = b
+			}
+		}
+		return best
+	}
+	return candidates[(p.next.Add(1)-1)%uint64(len(candidates))]
+}
+
+// unhealthy reports whether the error means the server itself is in trouble,
+// as opposed to a bad request.
+func unhealthy(err error) bool {
+	var statusErr *ollama.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/FlameInTheDark/disai/internal/config"
+)
+
+// Profile is a named model configuration users can switch between.
+type Profile struct {
+	Name        string
+	Description string
+	// ModelName is the name of the Ollama model, e.g. "qwen3:8b".
+	ModelName string
+	Vision    bool
+	// Generation holds the generation options merged with the global ones.
+	Generation config.Generation
+
+	tools     []string
+	systemTpl *template.Template
+	userTpl   *template.Template
+}
+
+func newProfile(name string, cfg config.Profile, caps config.Capabilities) (*Profile, error) {
+	p := &Profile{
+		Name:        name,
+		Description: cfg.Description,
+		ModelName:   cfg.Model,
+		Vision:      caps.Vision,
+		Generation:  cfg.Generation,
+		tools:       cfg.Tools,
+	}
+	if err := p.LoadTemplate(cfg.Templates.System, cfg.Templates.User); err != nil {
+		return nil, fmt.Errorf("profile %q: %w", name, err)
+	}
+	return p, nil
+}
+
+// allowsTool reports whether the tool belongs to the tool set of the profile.
+// Tools are matched by their full name or by the name without the MCP server prefix.
+func (p *Profile) allowsTool(rawName string) bool {
+	if len(p.tools) == 0 {
+		return true
+	}
+	if slices.Contains(p.tools, rawName) {
+		return true
+	}
+	if parts := strings.SplitN(rawName, "_", 2); len(parts) == 2 {
+		return slices.Contains(p.tools, parts[1])
+	}
+	return false
+}
+
+// ollamaOptions converts generation options into the Ollama options object.
+// keep_alive is not an option, it is sent as a separate request field.
+func ollamaOptions(g config.Generation) map[string]any {
+	opts := make(map[string]any)
+	if g.Temperature != nil {
+		opts["temperature"] = *g.Temperature
+	}
+	if g.TopP != nil {
+		opts["top_p"] = *g.TopP
+	}
+	if g.TopK != nil {
+		opts["top_k"] = *g.TopK
+	}
+	if g.ContextSize != nil {
+		opts["num_ctx"] = *g.ContextSize
+	}
+	if g.NumPredict != nil {
+		opts["num_predict"] = *g.NumPredict
+	}
+	if g.RepeatPenalty != nil {
+		opts["repeat_penalty"] = *g.RepeatPenalty
+	}
+	if g.Seed != nil {
+		opts["seed"] = *g.Seed
+	}
+	if len(opts) == 0 {
+		return nil
+	}
+	return opts
+}
@@ -0,0 +1,210 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// QueueStatusPrefix marks status updates about the queue position, so the
+// caller can replace the previous position instead of appending a new line.
+const QueueStatusPrefix = "⏳"
+
+var (
+	// ErrQueueFull is returned when the queue reached its maximum size.
+	ErrQueueFull = errors.New("the queue is full, try again later")
+	// ErrUserQueueFull is returned when the user already has too many queued jobs.
+	ErrUserQueueFull = errors.New("you already have too many requests in the queue")
+)
+
+type slotKey struct{}
+
+// Slot is a place on a backend taken from the queue. It moves to another
+// backend when a request fails over.
+type Slot struct {
+	p    *Pool
+	user string
+	// b and released are guarded by the pool mutex
+	b        *Backend
+	released bool
+}
+
+// Backend returns the backend the slot is currently on.
+func (s *Slot) Backend() *Backend {
+	s.p.mu.Lock()
+	defer s.p.mu.Unlock()
+	return s.b
+}
+
+// Release frees the slot for the next job in the queue, it is safe to call it twice.
+func (s *Slot) Release() {
+	s.p.mu.Lock()
+	defer s.p.mu.Unlock()
+	if s.released {
+		return
+	}
+	s.released = true
+	s.b.active--
+	s.p.forget(s.user)
+	s.p.dispatch()
+}
+
+type waiter struct {
+	user  string
+	ready chan *Backend
+	// moved holds the latest position of the waiter, pos is guarded by the pool mutex
+	moved chan int
+	pos   int
+}
+
+// Acquire waits for a free slot on any backend. The slot must be released when
+// the job is done. While the job waits, position is called with its 1-based
+// place in the queue every time it changes.
+func (p *Pool) Acquire(ctx context.Context, user string, position func(int)) (*Slot, error) {
+	if len(p.backends) == 0 {
+		return nil, ErrNoBackends
+	}
+
+	p.mu.Lock()
+	if p.maxPerUser > 0 && p.perUser[user] >= p.maxPerUser {
+		p.mu.Unlock()
+		return nil, ErrUserQueueFull
+	}
+	if len(p.waiting) == 0 {
+		if b := p.freeBackend(); b != nil {
+			b.active++
+			p.perUser[user]++
+			p.mu.Unlock()
+			return &Slot{p: p, user: user, b: b}, nil
+		}
+	}
+	if p.maxSize > 0 && len(p.waiting) >= p.maxSize {
+		p.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+	w := &waiter{user: user, ready: make(chan *Backend, 1), moved: make(chan int, 1)}
+	p.waiting = append(p.waiting, w)
+	p.perUser[user]++
+	w.pos = len(p.waiting)
+	w.moved <- w.pos
+	p.mu.Unlock()
+
+	for {
+		select {
+		case b := <-w.ready:
+			return &Slot{p: p, user: user, b: b}, nil
+		case pos := <-w.moved:
+			if position != nil {
+				position(pos)
+			}
+		case <-ctx.Done():
+			p.mu.Lock()
+			removed := p.remove(w)
+			if removed {
+				p.forget(user)
+				p.updatePositions()
+			}
+			p.mu.Unlock()
+			if !removed {
+				// The slot was assigned while the context was cancelled
+				(&Slot{p: p, user: user, b: <-w.ready}).Release()
+			}
+			return nil, fmt.Errorf("waiting in queue: %w", ctx.Err())
+		}
+	}
+}
+
+// QueueLength returns the number of jobs waiting for a free slot.
+func (p *Pool) QueueLength() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.waiting)
+}
+
+// move returns the backend of the slot for the next attempt of a request. When
+// the backend was tried already, the slot moves to an untried backend with a free
+// slot, so failover keeps the concurrency limits. It returns nil when there is none.
+func (p *Pool) move(s *Slot, tried map[*Backend]bool) *Backend {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !tried[s.b] {
+		return s.b
+	}
+	next := p.pick(func(b *Backend) bool { return !tried[b] && b.free() }, func(b *Backend) int64 { return int64(b.active) })
+	if next == nil {
+		return nil
+	}
+	s.b.active--
+	next.active++
+	s.b = next
+	p.dispatch()
+	return next
+}
+
+// dispatch hands free slots to the waiting jobs. Must be called with the mutex held.
+func (p *Pool) dispatch() {
+	dispatched := false
+	for len(p.waiting) > 0 {
+		next := p.freeBackend()
+		if next == nil {
+			break
+		}
+		w := p.waiting[0]
+		p.waiting = p.waiting[1:]
+		next.active++
+		w.ready <- next
+		dispatched = true
+	}
+	if dispatched {
+		p.updatePositions()
+	}
+}
+
+// forget decrements the job count of the user. Must be called with the mutex held.
+func (p *Pool) forget(user string) {
+	p.perUser[user]--
+	if p.perUser[user] <= 0 {
+		delete(p.perUser, user)
+	}
+}
+
+// freeBackend returns a backend with a free slot. Must be called with the mutex held.
+func (p *Pool) freeBackend() *Backend {
+	return p.pick((*Backend).free, func(b *Backend) int64 { return int64(b.active) })
+}
+
+// remove deletes the waiter from the queue. Must be called with the mutex held.
+func (p *Pool) remove(w *waiter) bool {
+	for i, cur := range p.waiting {
+		if cur == w {
+			p.waiting = append(p.waiting[:i], p.waiting[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// updatePositions tells every waiter its current position, replacing any
+// position it has not read yet. Must be called with the mutex held.
+func (p *Pool) updatePositions() {
+	for i, w := range p.waiting {
+		if w.pos == i+1 {
+			continue
+		}
+		w.pos = i + 1
+		select {
+		case <-w.moved:
+		default:
+		}
+		w.moved <- w.pos
+	}
+}
+
+func withSlot(ctx context.Context, s *Slot) context.Context {
+	return context.WithValue(ctx, slotKey{}, s)
+}
+
+func slotFromContext(ctx context.Context) *Slot {
+	s, _ := ctx.Value(slotKey{}).(*Slot)
+	return s
+}
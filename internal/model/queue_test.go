@@ -0,0 +1,150 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/FlameInTheDark/disai/internal/config"
+	"github.com/FlameInTheDark/disai/internal/ollama"
+)
+
+func newTestPool(servers map[string]string, queue config.Queue) *Pool {
+	return NewPool(servers, config.Balancing{Strategy: StrategyRoundRobin, Retries: 2}, queue)
+}
+
+func TestAcquirePositions(t *testing.T) {
+	p := newTestPool(map[string]string{"a": "http://a"}, config.Queue{Concurrency: 1})
+	ctx := context.Background()
+
+	first, err := p.Acquire(ctx, "u1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wait := func(user string) chan int {
+		positions := make(chan int, 10)
+		go func() {
+			if _, err := p.Acquire(ctx, user, func(pos int) { positions <- pos }); err != nil {
+				t.Error(err)
+			}
+		}()
+		return positions
+	}
+	second := wait("u2")
+	expectPosition(t, second, 1)
+	third := wait("u3")
+	expectPosition(t, third, 2)
+	if n := p.QueueLength(); n != 2 {
+		t.Fatalf("queue length %d, want 2", n)
+	}
+
+	first.Release()
+	expectPosition(t, third, 1)
+	if n := p.QueueLength(); n != 1 {
+		t.Fatalf("queue length %d, want 1", n)
+	}
+	// Releasing twice must not free a second slot
+	first.Release()
+	if n := p.QueueLength(); n != 1 {
+		t.Fatalf("queue length %d after a double release, want 1", n)
+	}
+}
+
+func expectPosition(t *testing.T, positions chan int, want int) {
+	t.Helper()
+	select {
+	case pos := <-positions:
+		if pos != want {
+			t.Fatalf("position %d, want %d", pos, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no position update, want %d", want)
+	}
+}
+
+func TestAcquireLimits(t *testing.T) {
+	p := newTestPool(map[string]string{"a": "http://a"}, config.Queue{Concurrency: 1, MaxPerUser: 1, MaxSize: 1})
+	ctx := context.Background()
+	if _, err := p.Acquire(ctx, "u1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Acquire(ctx, "u1", nil); !errors.Is(err, ErrUserQueueFull) {
+		t.Fatalf("got %v, want %v", err, ErrUserQueueFull)
+	}
+
+	waitCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() {
+		_, err := p.Acquire(waitCtx, "u2", nil)
+		done <- err
+	}()
+	for p.QueueLength() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := p.Acquire(ctx, "u3", nil); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("got %v, want %v", err, ErrQueueFull)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want a cancelled wait", err)
+	}
+	if n := p.QueueLength(); n != 0 {
+		t.Fatalf("queue length %d after cancelling, want 0", n)
+	}
+}
+
+func TestChatFailoverKeepsLimits(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"ok"},"done":true}`)
+	}))
+	defer working.Close()
+
+	p := newTestPool(map[string]string{"a": failing.URL, "b": working.URL}, config.Queue{Concurrency: 1})
+	ctx := context.Background()
+	// Round robin hands out a first, then b
+	onFailing, err := p.Acquire(ctx, "u1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	onWorking, err := p.Acquire(ctx, "u2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if onFailing.Backend().Name != "a" || onWorking.Backend().Name != "b" {
+		t.Fatalf("slots on %s and %s, want a and b", onFailing.Backend().Name, onWorking.Backend().Name)
+	}
+
+	req := &ollama.ChatRequest{Model: "m"}
+	if _, err := p.Chat(withSlot(ctx, onFailing), req, nil); !errors.Is(err, ErrNoBackends) {
+		t.Fatalf("got %v, want %v while b is busy", err, ErrNoBackends)
+	}
+
+	onWorking.Release()
+	resp, err := p.Chat(withSlot(ctx, onFailing), req, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Message.Content != "ok" {
+		t.Fatalf("got %q", resp.Message.Content)
+	}
+	if name := onFailing.Backend().Name; name != "b" {
+		t.Fatalf("slot is on %s after failover, want b", name)
+	}
+	// The slot left a, so a new job gets it right away
+	next, err := p.Acquire(ctx, "u3", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Backend().Name != "a" {
+		t.Fatalf("new slot on %s, want a", next.Backend().Name)
+	}
+}
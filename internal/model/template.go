@@ -2,25 +2,32 @@ package model
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"text/template"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/FlameInTheDark/disai/internal/metrics"
+	"github.com/FlameInTheDark/disai/internal/tracing"
 )
 
-func (m *Model) LoadTemplate(system, user string) {
+func (p *Profile) LoadTemplate(system, user string) error {
 	systpl, err := template.ParseFiles(system)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("system template: %w", err)
 	}
-	m.systemTpl = systpl
-
 	usertpl, err := template.ParseFiles(user)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("user template: %w", err)
 	}
-	m.userTpl = usertpl
+	p.systemTpl = systpl
+	p.userTpl = usertpl
+	return nil
 }
 
-func (m *Model) ExecuteUserTemplate(message string, args map[string]any) (string, error) {
+func (p *Profile) ExecuteUserTemplate(message string, args map[string]any) (string, error) {
 	var buf bytes.Buffer
 	var argsMap = make(map[string]any)
 	argsMap["Message"] = message
@@ -29,13 +36,13 @@ func (m *Model) ExecuteUserTemplate(message string, args map[string]any) (string
 			argsMap[k] = v
 		}
 	}
-	if err := m.userTpl.Execute(&buf, argsMap); err != nil {
+	if err := p.userTpl.Execute(&buf, argsMap); err != nil {
 		return "", fmt.Errorf("error executing template: %w", err)
 	}
 	return buf.String(), nil
 }
 
-func (m *Model) ExecuteSystemTemplate(args map[string]any) (string, error) {
+func (p *Profile) ExecuteSystemTemplate(args map[string]any) (string, error) {
 	var buf bytes.Buffer
 	var argsMap = make(map[string]any)
 	if args != nil {
@@ -43,8 +50,25 @@ func (m *Model) ExecuteSystemTemplate(args map[string]any) (string, error) {
 			argsMap[k] = v
 		}
 	}
-	if err := m.systemTpl.Execute(&buf, argsMap); err != nil {
+	if err := p.systemTpl.Execute(&buf, argsMap); err != nil {
 		return "", fmt.Errorf("error executing template: %w", err)
 	}
 	return buf.String(), nil
 }
+
+// executeTemplates renders the system and the user template of the request.
+func (p *Profile) executeTemplates(ctx context.Context, message string, args map[string]any) (system, user string, err error) {
+	start := time.Now()
+	_, span := tracing.Start(ctx, "template", attribute.String("profile", p.Name))
+	defer func() {
+		tracing.End(span, err)
+		metrics.Phase(metrics.PhaseTemplate, time.Since(start))
+	}()
+	if system, err = p.ExecuteSystemTemplate(args); err != nil {
+		return "", "", err
+	}
+	if user, err = p.ExecuteUserTemplate(message, args); err != nil {
+		return "", "", err
+	}
+	return system, user, nil
+}
@@ -0,0 +1,181 @@
+package model
+
+import "strings"
+
+// thinkTags maps opening reasoning tags to their closing tags.
+var thinkTags = []struct{ open, close string }{
+	{"<think>", "</think>"},
+	{"<thinking>", "</thinking>"},
+}
+
+// Chunk is a piece of streamed model output.
+type Chunk struct {
+	Text string
+	// Thinking is set for text inside a reasoning block.
+	Thinking bool
+	// Moved is set when the answer streamed so far turns out to be reasoning, because
+	// the chat template opened the block and only the closing tag was streamed.
+	// Text then holds the whole reasoning and the streamed answer is dropped.
+	Moved bool
+}
+
+// StreamCallback receives streamed model output.
+type StreamCallback func(chunk Chunk)
+
+// SplitThinking separates reasoning blocks from the answer. It accepts both
+// <think> and <thinking> tags with or without surrounding newlines, several
+// blocks in one text, a closing tag without an opening one (when the chat
+// template already opened the block) and a block that was never closed.
+func SplitThinking(text string) (reasoning, answer string) {
+	var thoughts, parts []string
+	if idx, tag := indexClose(text); idx >= 0 {
+		if open, _ := indexOpen(text); open < 0 || open > idx {
+			thoughts = append(thoughts, text[:idx])
+			text = text[idx+len(tag):]
+		}
+	}
+	for text != "" {
+		idx, i := indexOpen(text)
+		if idx < 0 {
+			parts = append(parts, text)
+			break
+		}
+		parts = append(parts, text[:idx])
+		text = text[idx+len(thinkTags[i].open):]
+		end := strings.Index(text, thinkTags[i].close)
+		if end < 0 {
+			thoughts = append(thoughts, text)
+			break
+		}
+		thoughts = append(thoughts, text[:end])
+		text = text[end+len(thinkTags[i].close):]
+	}
+	return joinTrimmed(thoughts), joinTrimmed(parts)
+}
+
+// indexOpen returns the position of the first opening tag and its index in thinkTags.
+func indexOpen(text string) (int, int) {
+	pos, tag := -1, -1
+	for i, t := range thinkTags {
+		if idx := strings.Index(text, t.open); idx >= 0 && (pos < 0 || idx < pos) {
+			pos, tag = idx, i
+		}
+	}
+	return pos, tag
+}
+
+// indexClose returns the position of the first closing tag and the tag itself.
+func indexClose(text string) (int, string) {
+	pos, tag := -1, ""
+	for _, t := range thinkTags {
+		if idx := strings.Index(text, t.close); idx >= 0 && (pos < 0 || idx < pos) {
+			pos, tag = idx, t.close
+		}
+	}
+	return pos, tag
+}
+
+func joinTrimmed(parts []string) string {
+	var out []string
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, "\n\n")
+}
+
+// thinkSplitter separates reasoning blocks from the answer in streamed text.
+// Tags split across chunk boundaries are kept until the next chunk arrives.
+// Until the first tag shows up the text is streamed as the answer, a closing tag
+// without an opening one moves it to the reasoning like SplitThinking does.
+type thinkSplitter struct {
+	emit     StreamCallback
+	thinking bool
+	close    string
+	pending  string
+	// tagged is set once any tag was seen
+	tagged bool
+	// untagged is the answer text streamed before the first tag
+	untagged strings.Builder
+}
+
+// Write feeds the next piece of streamed text.
+func (t *thinkSplitter) Write(text string) {
+	buf := t.pending + text
+	t.pending = ""
+	for buf != "" {
+		if t.thinking {
+			if idx := strings.Index(buf, t.close); idx >= 0 {
+				t.send(buf[:idx])
+				buf = buf[idx+len(t.close):]
+				t.thinking = false
+				continue
+			}
+			t.hold(buf, t.close)
+			return
+		}
+		open, i := indexOpen(buf)
+		if !t.tagged {
+			if idx, tag := indexClose(buf); idx >= 0 && (open < 0 || idx < open) {
+				t.untagged.WriteString(buf[:idx])
+				t.emit(Chunk{Text: t.untagged.String(), Thinking: true, Moved: true})
+				t.untagged.Reset()
+				buf = buf[idx+len(tag):]
+				t.tagged = true
+				continue
+			}
+		}
+		if open >= 0 {
+			t.send(buf[:open])
+			buf = buf[open+len(thinkTags[i].open):]
+			t.thinking, t.close, t.tagged = true, thinkTags[i].close, true
+			continue
+		}
+		var tags []string
+		for _, tag := range thinkTags {
+			tags = append(tags, tag.open)
+			if !t.tagged {
+				tags = append(tags, tag.close)
+			}
+		}
+		t.hold(buf, tags...)
+		return
+	}
+}
+
+// Flush emits text held back as a possible tag start.
+func (t *thinkSplitter) Flush() {
+	t.send(t.pending)
+	t.pending = ""
+}
+
+// hold sends the text except for a suffix that may be the start of one of the tags.
+func (t *thinkSplitter) hold(buf string, tags ...string) {
+	keep := 0
+	for _, tag := range tags {
+		keep = max(keep, partialSuffix(buf, tag))
+	}
+	t.send(buf[:len(buf)-keep])
+	t.pending = buf[len(buf)-keep:]
+}
+
+func (t *thinkSplitter) send(text string) {
+	if text == "" {
+		return
+	}
+	if !t.tagged {
+		t.untagged.WriteString(text)
+	}
+	t.emit(Chunk{Text: text, Thinking: t.thinking})
+}
+
+// partialSuffix returns the length of the longest suffix of s that is a prefix of tag.
+func partialSuffix(s, tag string) int {
+	for n := min(len(s), len(tag)-1); n > 0; n-- {
+		if strings.HasSuffix(s, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitThinking(t *testing.T) {
+	tests := []struct {
+		name          string
+		text          string
+		wantReasoning string
+		wantAnswer    string
+	}{
+		{name: "no reasoning", text: "Hello", wantAnswer: "Hello"},
+		{name: "think tag", text: "<think>\nhmm\n</think>\n\nHello", wantReasoning: "hmm", wantAnswer: "Hello"},
+		{name: "thinking tag", text: "<thinking>hmm</thinking>Hello", wantReasoning: "hmm", wantAnswer: "Hello"},
+		{name: "several blocks", text: "<think>a</think>Hello<think>b</think> world", wantReasoning: "a\n\nb", wantAnswer: "Hello\n\nworld"},
+		{name: "closing tag only", text: "hmm</think>Hello", wantReasoning: "hmm", wantAnswer: "Hello"},
+		{name: "never closed", text: "Hi<think>still thinking", wantReasoning: "still thinking", wantAnswer: "Hi"},
+		{name: "empty block", text: "<think></think>Hello", wantAnswer: "Hello"},
+		{name: "only reasoning", text: "<think>hmm</think>", wantReasoning: "hmm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reasoning, answer := SplitThinking(tt.text)
+			if reasoning != tt.wantReasoning {
+				t.Errorf("reasoning = %q, want %q", reasoning, tt.wantReasoning)
+			}
+			if answer != tt.wantAnswer {
+				t.Errorf("answer = %q, want %q", answer, tt.wantAnswer)
+			}
+		})
+	}
+}
+
+func TestThinkSplitter(t *testing.T) {
+	tests := []struct {
+		name          string
+		chunks        []string
+		wantReasoning string
+		wantAnswer    string
+	}{
+		{name: "plain", chunks: []string{"Hel", "lo"}, wantAnswer: "Hello"},
+		{name: "whole tags", chunks: []string{"<think>hmm</think>", "Hello"}, wantReasoning: "hmm", wantAnswer: "Hello"},
+		{name: "tags split across chunks", chunks: []string{"<th", "ink>h", "mm</thi", "nk>Hel", "lo"}, wantReasoning: "hmm", wantAnswer: "Hello"},
+		{name: "thinking tag", chunks: []string{"<thinking>", "hmm", "</thinking>", "Hi"}, wantReasoning: "hmm", wantAnswer: "Hi"},
+		{name: "text that looks like a tag start", chunks: []string{"a <", "b"}, wantAnswer: "a <b"},
+		{name: "pending text is flushed", chunks: []string{"x <thi"}, wantAnswer: "x <thi"},
+		{name: "closing tag only", chunks: []string{"hmm</think>Hello"}, wantReasoning: "hmm", wantAnswer: "Hello"},
+		{name: "closing tag only across chunks", chunks: []string{"hm", "m</thi", "nk>Hel", "lo"}, wantReasoning: "hmm", wantAnswer: "Hello"},
+		{name: "closing tag after a block is text", chunks: []string{"<think>a</think>b", "</think>"}, wantReasoning: "a", wantAnswer: "b</think>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reasoning, answer strings.Builder
+			s := &thinkSplitter{emit: func(c Chunk) {
+				if c.Moved {
+					answer.Reset()
+				}
+				if c.Thinking {
+					reasoning.WriteString(c.Text)
+				} else {
+					answer.WriteString(c.Text)
+				}
+			}}
+			for _, chunk := range tt.chunks {
+				s.Write(chunk)
+			}
+			s.Flush()
+			if reasoning.String() != tt.wantReasoning {
+				t.Errorf("reasoning = %q, want %q", reasoning.String(), tt.wantReasoning)
+			}
+			if answer.String() != tt.wantAnswer {
+				t.Errorf("answer = %q, want %q", answer.String(), tt.wantAnswer)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/firebase/genkit/go/ai"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/FlameInTheDark/disai/internal/tracing"
+)
+
+// traceTurns starts a span for every model turn of a request.
+func traceTurns(modelName string) ai.ModelMiddleware {
+	var turns atomic.Int64
+	return func(next ai.ModelFunc) ai.ModelFunc {
+		return func(ctx context.Context, req *ai.ModelRequest, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+			turn := turns.Add(1)
+			ctx, span := tracing.Start(ctx, "model turn "+strconv.FormatInt(turn, 10),
+				attribute.String("model.name", modelName),
+				attribute.Int64("model.turn", turn),
+				attribute.Int("model.messages", len(req.Messages)),
+			)
+			resp, err := next(ctx, req, cb)
+			if err == nil {
+				span.SetAttributes(attribute.String("model.finish_reason", string(resp.FinishReason)))
+				if resp.Usage != nil {
+					span.SetAttributes(
+						attribute.Int("model.input_tokens", resp.Usage.InputTokens),
+						attribute.Int("model.output_tokens", resp.Usage.OutputTokens),
+					)
+				}
+			}
+			tracing.End(span, err)
+			return resp, err
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+
+	"github.com/FlameInTheDark/disai/internal/ollama"
+)
+
+// Usage sums the tokens of all model turns of a request, tool turns included.
+type Usage struct {
+	InputTokens  int
+	OutputTokens int
+	// Turns is the number of model calls.
+	Turns int
+	// EvalDuration is the time the model spent generating the output tokens as
+	// reported by Ollama, without prompt evaluation, model loading and retries.
+	EvalDuration time.Duration
+}
+
+// TokensPerSecond returns the output speed of the model, zero when unknown.
+func (u Usage) TokensPerSecond() float64 {
+	if u.OutputTokens == 0 || u.EvalDuration <= 0 {
+		return 0
+	}
+	return float64(u.OutputTokens) / u.EvalDuration.Seconds()
+}
+
+// usageCounter collects the usage reported by every model turn.
+type usageCounter struct {
+	mu    sync.Mutex
+	usage Usage
+}
+
+func (c *usageCounter) middleware(next ai.ModelFunc) ai.ModelFunc {
+	return func(ctx context.Context, req *ai.ModelRequest, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+		resp, err := next(ctx, req, cb)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.usage.Turns++
+		if err == nil && resp.Usage != nil {
+			c.usage.InputTokens += resp.Usage.InputTokens
+			c.usage.OutputTokens += resp.Usage.OutputTokens
+			c.usage.EvalDuration += time.Duration(resp.Usage.Custom[ollama.UsageEvalDuration])
+		}
+		return resp, err
+	}
+}
+
+func (c *usageCounter) get() Usage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.usage
+}
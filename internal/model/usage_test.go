@@ -0,0 +1,42 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+
+	"github.com/FlameInTheDark/disai/internal/ollama"
+)
+
+func TestUsageCounter(t *testing.T) {
+	c := &usageCounter{}
+	turn := c.middleware(func(ctx context.Context, req *ai.ModelRequest, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+		// A slow call, e.g. loading the model, must not lower the speed
+		return &ai.ModelResponse{
+			LatencyMs: 60000,
+			Usage: &ai.GenerationUsage{
+				InputTokens:  100,
+				OutputTokens: 50,
+				Custom:       map[string]float64{ollama.UsageEvalDuration: float64(time.Second)},
+			},
+		}, nil
+	})
+	for range 2 {
+		if _, err := turn(context.Background(), &ai.ModelRequest{}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := c.get()
+	want := Usage{InputTokens: 200, OutputTokens: 100, Turns: 2, EvalDuration: 2 * time.Second}
+	if got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if speed := got.TokensPerSecond(); speed != 50 {
+		t.Errorf("got %v tokens/s, want 50", speed)
+	}
+	if speed := (Usage{OutputTokens: 10}).TokensPerSecond(); speed != 0 {
+		t.Errorf("unknown generation time gives %v tokens/s", speed)
+	}
+}
@@ -0,0 +1,141 @@
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ErrUnexpectedEOS is returned when a chat stream ends before the final chunk.
+var ErrUnexpectedEOS = errors.New("unexpected end of stream")
+
+// StatusError is returned when the server answers with a non-200 status.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("ollama %s: status %d: %s", e.URL, e.StatusCode, e.Body)
+}
+
+// Client talks to a single Ollama server over its HTTP API.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// NewClient creates a client for the Ollama server at baseURL.
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    &http.Client{},
+	}
+}
+
+// BaseURL returns the server address of the client.
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// Ping checks that the server is reachable and responds to API requests.
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/version", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ollama %s: unexpected status %d", c.baseURL, resp.StatusCode)
+	}
+	return nil
+}
+
+// Chat sends a chat request. When the request is streamed, fn is called for every
+// received chunk and the returned response holds the merged message of all chunks.
+func (c *Client) Chat(ctx context.Context, chatReq *ChatRequest, fn func(*ChatResponse) error) (*ChatResponse, error) {
+	body, err := json.Marshal(chatReq)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return nil, &StatusError{URL: c.baseURL, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(data))}
+	}
+
+	if !chatReq.Stream {
+		var out ChatResponse
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			return nil, fmt.Errorf("ollama %s: decode response: %w", c.baseURL, err)
+		}
+		return &out, nil
+	}
+
+	var (
+		merged  ChatResponse
+		content strings.Builder
+		done    bool
+	)
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var chunk ChatResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return nil, fmt.Errorf("ollama %s: decode chunk: %w", c.baseURL, err)
+		}
+		if chunk.Error != "" {
+			return nil, fmt.Errorf("ollama %s: %s", c.baseURL, chunk.Error)
+		}
+		content.WriteString(chunk.Message.Content)
+		merged.Message.ToolCalls = append(merged.Message.ToolCalls, chunk.Message.ToolCalls...)
+		if fn != nil {
+			if err := fn(&chunk); err != nil {
+				return nil, err
+			}
+		}
+		if chunk.Done {
+			done = true
+			toolCalls := merged.Message.ToolCalls
+			merged = chunk
+			merged.Message.ToolCalls = toolCalls
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("ollama %s: read stream: %w", c.baseURL, err)
+	}
+	// A stream cut by a crashed server or a proxy ends without the final chunk
+	if !done {
+		return nil, fmt.Errorf("ollama %s: %w", c.baseURL, ErrUnexpectedEOS)
+	}
+	merged.Message.Role = "assistant"
+	merged.Message.Content = content.String()
+	return &merged, nil
+}
@@ -0,0 +1,59 @@
+package ollama
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChatStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr error
+	}{
+		{
+			name: "complete",
+			body: `{"message":{"role":"assistant","content":"Hel"},"done":false}` + "\n" +
+				`{"message":{"role":"assistant","content":"lo"},"done":false}` + "\n" +
+				`{"message":{"role":"assistant","content":""},"done":true,"eval_count":2}` + "\n",
+			want: "Hello",
+		},
+		{
+			name:    "cut without the final chunk",
+			body:    `{"message":{"role":"assistant","content":"Hel"},"done":false}` + "\n",
+			wantErr: ErrUnexpectedEOS,
+		},
+		{
+			name:    "empty",
+			body:    "",
+			wantErr: ErrUnexpectedEOS,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, tt.body)
+			}))
+			defer srv.Close()
+
+			resp, err := NewClient(srv.URL).Chat(context.Background(), &ChatRequest{Model: "m", Stream: true}, nil)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Message.Content != tt.want {
+				t.Errorf("got %q, want %q", resp.Message.Content, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package ollama
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// UsageEvalDuration is the key of the generation time in nanoseconds in the custom usage
+// of model responses, prompt evaluation and model loading are not included.
+const UsageEvalDuration = "evalDuration"
+
+var roleMapping = map[ai.Role]string{
+	ai.RoleUser:   "user",
+	ai.RoleModel:  "assistant",
+	ai.RoleSystem: "system",
+	ai.RoleTool:   "tool",
+}
+
+// NewChatRequest converts a Genkit model request into an Ollama chat request.
+func NewChatRequest(model string, req *ai.ModelRequest) (*ChatRequest, error) {
+	chatReq := &ChatRequest{Model: model}
+	for _, msg := range req.Messages {
+		converted, err := convertMessage(msg)
+		if err != nil {
+			return nil, err
+		}
+		chatReq.Messages = append(chatReq.Messages, converted...)
+	}
+	for _, tool := range req.Tools {
+		chatReq.Tools = append(chatReq.Tools, Tool{
+			Type: "function",
+			Function: Function{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.InputSchema,
+			},
+		})
+	}
+	return chatReq, nil
+}
+
+// ModelResponse converts a complete chat response into a Genkit response.
+func (r *ChatResponse) ModelResponse(req *ai.ModelRequest) *ai.ModelResponse {
+	resp := &ai.ModelResponse{
+		Request:      req,
+		FinishReason: finishReason(r.DoneReason),
+		Message: &ai.Message{
+			Role:    ai.RoleModel,
+			Content: r.parts(),
+		},
+		Usage: &ai.GenerationUsage{
+			InputTokens:  r.PromptEvalCount,
+			OutputTokens: r.EvalCount,
+			TotalTokens:  r.PromptEvalCount + r.EvalCount,
+			Custom:       map[string]float64{UsageEvalDuration: float64(r.EvalDuration)},
+		},
+	}
+	if r.TotalDuration > 0 {
+		resp.LatencyMs = float64(r.TotalDuration) / 1e6
+	}
+	return resp
+}
+
+// ModelResponseChunk converts a streamed chunk into a Genkit chunk.
+func (r *ChatResponse) ModelResponseChunk() *ai.ModelResponseChunk {
+	return &ai.ModelResponseChunk{
+		Role:    ai.RoleModel,
+		Content: r.parts(),
+	}
+}
+
+func (r *ChatResponse) parts() []*ai.Part {
+	var parts []*ai.Part
+	if r.Message.Content != "" {
+		parts = append(parts, ai.NewTextPart(r.Message.Content))
+	}
+	for _, call := range r.Message.ToolCalls {
+		parts = append(parts, ai.NewToolRequestPart(&ai.ToolRequest{
+			Name:  call.Function.Name,
+			Input: call.Function.Arguments,
+		}))
+	}
+	return parts
+}
+
+func finishReason(reason string) ai.FinishReason {
+	switch reason {
+	case "length":
+		return ai.FinishReasonLength
+	case "", "stop":
+		return ai.FinishReasonStop
+	default:
+		return ai.FinishReasonOther
+	}
+}
+
+// convertMessage converts a Genkit message. Tool responses are split into
+// separate messages because Ollama expects one tool message per call.
+func convertMessage(msg *ai.Message) ([]Message, error) {
+	role, ok := roleMapping[msg.Role]
+	if !ok {
+		return nil, fmt.Errorf("unsupported role %q", msg.Role)
+	}
+	out := Message{Role: role}
+	var (
+		content   strings.Builder
+		responses []Message
+	)
+	for _, part := range msg.Content {
+		switch {
+		case part.IsText():
+			content.WriteString(part.Text)
+		case part.IsReasoning():
+			// Reasoning is not replayed to the model
+		case part.IsMedia():
+			image, err := mediaData(part.Text)
+			if err != nil {
+				return nil, err
+			}
+			out.Images = append(out.Images, image)
+		case part.IsToolRequest():
+			out.ToolCalls = append(out.ToolCalls, ToolCall{
+				Function: FunctionCall{
+					Name:      part.ToolRequest.Name,
+					Arguments: part.ToolRequest.Input,
+				},
+			})
+		case part.IsToolResponse():
+			data, err := json.Marshal(part.ToolResponse.Output)
+			if err != nil {
+				return nil, fmt.Errorf("marshal tool response %s: %w", part.ToolResponse.Name, err)
+			}
+			responses = append(responses, Message{Role: "tool", Content: string(data)})
+		default:
+			return nil, errors.New("unsupported message part")
+		}
+	}
+	if len(responses) > 0 && content.Len() == 0 && len(out.ToolCalls) == 0 {
+		return responses, nil
+	}
+	out.Content = content.String()
+	return append([]Message{out}, responses...), nil
+}
+
+// mediaData extracts base64 data from a data URL.
+func mediaData(url string) (string, error) {
+	if !strings.HasPrefix(url, "data:") {
+		return "", errors.New("only data URLs are supported for media")
+	}
+	_, data, ok := strings.Cut(url, ";base64,")
+	if !ok {
+		return "", errors.New("media data URL must be base64 encoded")
+	}
+	return data, nil
+}
@@ -0,0 +1,59 @@
+package ollama
+
+// ChatRequest is the body of the /api/chat endpoint.
+type ChatRequest struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+	Tools    []Tool    `json:"tools,omitempty"`
+	Stream   bool      `json:"stream"`
+	// Options holds model parameters such as temperature or num_ctx.
+	Options map[string]any `json:"options,omitempty"`
+	// KeepAlive controls how long the model stays loaded, e.g. "5m".
+	KeepAlive string `json:"keep_alive,omitempty"`
+}
+
+// Message is a single chat message in the Ollama format.
+type Message struct {
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	Images    []string   `json:"images,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+}
+
+// Tool describes a function the model is allowed to call.
+type Tool struct {
+	Type     string   `json:"type"`
+	Function Function `json:"function"`
+}
+
+// Function is the definition of a callable tool.
+type Function struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters"`
+}
+
+// ToolCall is a function call requested by the model.
+type ToolCall struct {
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall holds the name and arguments of a requested call.
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments any    `json:"arguments"`
+}
+
+// ChatResponse is a response or a streamed chunk of the /api/chat endpoint.
+type ChatResponse struct {
+	Model           string  `json:"model"`
+	CreatedAt       string  `json:"created_at"`
+	Message         Message `json:"message"`
+	Done            bool    `json:"done"`
+	DoneReason      string  `json:"done_reason,omitempty"`
+	TotalDuration   int64   `json:"total_duration,omitempty"`
+	PromptEvalCount int     `json:"prompt_eval_count,omitempty"`
+	EvalCount       int     `json:"eval_count,omitempty"`
+	EvalDuration    int64   `json:"eval_duration,omitempty"`
+	Error           string  `json:"error,omitempty"`
+}
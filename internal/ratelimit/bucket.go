@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/FlameInTheDark/disai/internal/config"
+)
+
+// maxBuckets is the number of buckets kept before refilled ones are dropped
+const maxBuckets = 10000
+
+// bucket is a token bucket holding up to Rate requests, refilled by Rate every Period.
+type bucket struct {
+	tokens float64
+	last   time.Time
+	period time.Duration
+}
+
+// bucket returns the bucket of the key or nil when the limit has no rate,
+// must be called with the mutex held.
+func (l *Limiter) bucket(key string, limit config.Limit, now time.Time) *bucket {
+	if limit.Rate <= 0 || limit.Period <= 0 {
+		return nil
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Rate), last: now}
+		l.buckets[key] = b
+	}
+	b.period = limit.Period
+	return b
+}
+
+// wait refills the bucket and returns how long to wait for the next request.
+func (b *bucket) wait(limit config.Limit, now time.Time) time.Duration {
+	if b == nil {
+		return 0
+	}
+	rate := perSecond(limit)
+	b.tokens = min(float64(limit.Rate), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+func (b *bucket) take() {
+	if b != nil {
+		b.tokens--
+	}
+}
+
+// prune drops buckets idle long enough to be full again once there are many of them,
+// must be called with the mutex held.
+func (l *Limiter) prune(now time.Time) {
+	if len(l.buckets) < maxBuckets {
+		return
+	}
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= b.period {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// perSecond returns the refill rate of the limit in requests per second.
+func perSecond(l config.Limit) float64 {
+	return float64(l.Rate) / l.Period.Seconds()
+}
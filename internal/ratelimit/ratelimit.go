@@ -0,0 +1,233 @@
+// Package ratelimit enforces request rates with token buckets and daily
+// request and token quotas kept in per-day counters.
+package ratelimit
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/FlameInTheDark/disai/internal/access"
+	"github.com/FlameInTheDark/disai/internal/config"
+	"github.com/FlameInTheDark/disai/internal/storage"
+)
+
+// LimitError is returned when a subject is over a limit.
+type LimitError struct {
+	// Reason describes the exceeded limit.
+	Reason string
+	// RetryAt is when the subject can try again.
+	RetryAt time.Time
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s, retry at %s", e.Reason, e.RetryAt.Format(time.RFC3339))
+}
+
+// Limiter checks requests against the configured limits.
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	// day is the UTC day the usage counters belong to
+	day    time.Time
+	users  map[string]*usage
+	guilds map[string]*usage
+	st     storage.Store
+	now    func() time.Time
+}
+
+// New creates a limiter whose daily counters start from the request log of the storage.
+func New(st storage.Store) *Limiter {
+	return &Limiter{
+		buckets: make(map[string]*bucket),
+		st:      st,
+		now:     time.Now,
+	}
+}
+
+// Allow checks the daily quotas and takes a request from the rate buckets of
+// the user and the guild. An allowed request counts towards the quotas right
+// away, so running requests are counted too. Exempt users and roles are never
+// limited, but their requests count towards the guild.
+func (l *Limiter) Allow(cfg config.Limits, s access.Subject) error {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.rollover(now); err != nil {
+		return err
+	}
+	userUsage := l.usage(l.users, s.UserID)
+	guildUsage := l.usage(l.guilds, s.GuildID)
+	if exempt(cfg.Exempt, s) {
+		userUsage.reserve()
+		guildUsage.reserve()
+		return nil
+	}
+	user := effective(cfg, s)
+
+	tomorrow := l.day.Add(24 * time.Hour)
+	if reason := userUsage.exceeds(user); reason != "" {
+		return &LimitError{Reason: "You reached your daily " + reason, RetryAt: tomorrow}
+	}
+	if reason := guildUsage.exceeds(cfg.GuildTotal); reason != "" {
+		return &LimitError{Reason: "This server reached its daily " + reason, RetryAt: tomorrow}
+	}
+
+	userBucket := l.bucket("user:"+s.UserID, user, now)
+	var guildBucket *bucket
+	if s.GuildID != "" {
+		guildBucket = l.bucket("guild:"+s.GuildID, cfg.GuildTotal, now)
+	}
+	// Check both buckets before taking, so a denied request costs nothing
+	if wait := userBucket.wait(user, now); wait > 0 {
+		return &LimitError{Reason: "You are sending requests too fast", RetryAt: now.Add(wait)}
+	}
+	if wait := guildBucket.wait(cfg.GuildTotal, now); wait > 0 {
+		return &LimitError{Reason: "This server is sending requests too fast", RetryAt: now.Add(wait)}
+	}
+	userBucket.take()
+	guildBucket.take()
+	userUsage.reserve()
+	guildUsage.reserve()
+	l.prune(now)
+	return nil
+}
+
+// Record adds the tokens of a finished request to the daily counters.
+// Requests started on an earlier day are not counted.
+func (l *Limiter) Record(userID, guildID string, started time.Time, tokens int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !started.UTC().Truncate(24 * time.Hour).Equal(l.day) {
+		return
+	}
+	l.usage(l.users, userID).tokens += tokens
+	if u := l.usage(l.guilds, guildID); u != nil {
+		u.tokens += tokens
+	}
+}
+
+// rollover starts new counters when the day changes. They begin with the
+// requests already in today's log, e.g. from before a restart.
+// Must be called with the mutex held.
+func (l *Limiter) rollover(now time.Time) error {
+	day := now.UTC().Truncate(24 * time.Hour)
+	if day.Equal(l.day) {
+		return nil
+	}
+	users := make(map[string]*usage)
+	guilds := make(map[string]*usage)
+	err := l.st.Requests(day, now.Add(time.Second), func(r *storage.RequestLog) error {
+		l.usage(users, r.UserID).add(r)
+		if u := l.usage(guilds, r.GuildID); u != nil {
+			u.add(r)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	l.day, l.users, l.guilds = day, users, guilds
+	return nil
+}
+
+// usage returns the counter of the key, or nil for an empty key like the guild of a DM.
+func (l *Limiter) usage(counters map[string]*usage, key string) *usage {
+	if key == "" {
+		return nil
+	}
+	u, ok := counters[key]
+	if !ok {
+		u = &usage{}
+		counters[key] = u
+	}
+	return u
+}
+
+type usage struct {
+	requests int
+	tokens   int
+}
+
+func (u *usage) add(r *storage.RequestLog) {
+	u.requests++
+	u.tokens += r.InputTokens + r.OutputTokens
+}
+
+func (u *usage) reserve() {
+	if u != nil {
+		u.requests++
+	}
+}
+
+// exceeds returns the name of the exhausted quota.
+func (u *usage) exceeds(l config.Limit) string {
+	switch {
+	case u == nil:
+		return ""
+	case l.DailyRequests > 0 && u.requests >= l.DailyRequests:
+		return fmt.Sprintf("request limit (%d)", l.DailyRequests)
+	case l.DailyTokens > 0 && u.tokens >= l.DailyTokens:
+		return fmt.Sprintf("token limit (%d)", l.DailyTokens)
+	}
+	return ""
+}
+
+// effective returns the limit of the subject: a matching role wins over the guild,
+// which wins over the default. With several matching roles the most generous one applies.
+func effective(cfg config.Limits, s access.Subject) config.Limit {
+	limit := cfg.Default
+	if l, ok := cfg.Guilds[s.GuildID]; ok && s.GuildID != "" {
+		limit = l
+	}
+	var roles []config.Limit
+	for _, role := range s.Roles {
+		if l, ok := cfg.Roles[role]; ok {
+			roles = append(roles, l)
+		}
+	}
+	if len(roles) == 0 {
+		return limit
+	}
+	best := roles[0]
+	for _, l := range roles[1:] {
+		best = generous(best, l)
+	}
+	return best
+}
+
+// generous merges two limits taking the higher allowance of every field, zero means unlimited.
+func generous(a, b config.Limit) config.Limit {
+	more := func(x, y int) int {
+		if x == 0 || y == 0 {
+			return 0
+		}
+		return max(x, y)
+	}
+	out := config.Limit{
+		DailyRequests: more(a.DailyRequests, b.DailyRequests),
+		DailyTokens:   more(a.DailyTokens, b.DailyTokens),
+	}
+	switch {
+	case a.Rate == 0 || b.Rate == 0:
+	case perSecond(a) >= perSecond(b):
+		out.Rate, out.Period = a.Rate, a.Period
+	default:
+		out.Rate, out.Period = b.Rate, b.Period
+	}
+	return out
+}
+
+func exempt(e config.AccessList, s access.Subject) bool {
+	if slices.Contains(e.Users, s.UserID) || (s.GuildID != "" && slices.Contains(e.Guilds, s.GuildID)) ||
+		slices.Contains(e.Channels, s.ChannelID) {
+		return true
+	}
+	for _, role := range s.Roles {
+		if slices.Contains(e.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package ratelimit
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/FlameInTheDark/disai/internal/access"
+	"github.com/FlameInTheDark/disai/internal/config"
+	"github.com/FlameInTheDark/disai/internal/storage"
+)
+
+// newLimiter returns a limiter over an in-memory store with a clock the test moves.
+func newLimiter(t *testing.T) (*Limiter, storage.Store, *time.Time) {
+	t.Helper()
+	st := storage.NewMemory()
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	l := New(st)
+	l.now = func() time.Time { return now }
+	return l, st, &now
+}
+
+func limitError(t *testing.T, err error) *LimitError {
+	t.Helper()
+	var limit *LimitError
+	if !errors.As(err, &limit) {
+		t.Fatalf("got %v, want a *LimitError", err)
+	}
+	return limit
+}
+
+var alice = access.Subject{UserID: "alice", GuildID: "guild", ChannelID: "channel"}
+
+func TestRate(t *testing.T) {
+	l, _, now := newLimiter(t)
+	cfg := config.Limits{Default: config.Limit{Rate: 2, Period: time.Minute}}
+	for range 2 {
+		if err := l.Allow(cfg, alice); err != nil {
+			t.Fatal(err)
+		}
+	}
+	limit := limitError(t, l.Allow(cfg, alice))
+	if want := now.Add(30 * time.Second); !limit.RetryAt.Equal(want) {
+		t.Errorf("retry at %s, want %s", limit.RetryAt, want)
+	}
+	if err := l.Allow(cfg, access.Subject{UserID: "bob"}); err != nil {
+		t.Errorf("another user is limited: %v", err)
+	}
+	*now = now.Add(30 * time.Second)
+	if err := l.Allow(cfg, alice); err != nil {
+		t.Errorf("refilled bucket is limited: %v", err)
+	}
+}
+
+func TestGuildTotal(t *testing.T) {
+	l, _, _ := newLimiter(t)
+	cfg := config.Limits{GuildTotal: config.Limit{Rate: 1, Period: time.Hour}}
+	if err := l.Allow(cfg, alice); err != nil {
+		t.Fatal(err)
+	}
+	bob := access.Subject{UserID: "bob", GuildID: "guild"}
+	if limit := limitError(t, l.Allow(cfg, bob)); limit.Reason != "This server is sending requests too fast" {
+		t.Errorf("reason %q", limit.Reason)
+	}
+	if err := l.Allow(cfg, access.Subject{UserID: "bob"}); err != nil {
+		t.Errorf("DM is limited by the guild total: %v", err)
+	}
+}
+
+func TestDailyRequestsCountRunningRequests(t *testing.T) {
+	l, _, now := newLimiter(t)
+	cfg := config.Limits{Default: config.Limit{DailyRequests: 2}}
+	// Nothing is recorded, both requests are still running
+	for range 2 {
+		if err := l.Allow(cfg, alice); err != nil {
+			t.Fatal(err)
+		}
+	}
+	limit := limitError(t, l.Allow(cfg, alice))
+	if want := time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC); !limit.RetryAt.Equal(want) {
+		t.Errorf("retry at %s, want %s", limit.RetryAt, want)
+	}
+	*now = now.Add(12 * time.Hour)
+	if err := l.Allow(cfg, alice); err != nil {
+		t.Errorf("quota not reset the next day: %v", err)
+	}
+}
+
+func TestDailyTokens(t *testing.T) {
+	l, _, now := newLimiter(t)
+	cfg := config.Limits{GuildTotal: config.Limit{DailyTokens: 100}}
+	if err := l.Allow(cfg, alice); err != nil {
+		t.Fatal(err)
+	}
+	l.Record(alice.UserID, alice.GuildID, *now, 60)
+	// Requests from yesterday do not count today
+	l.Record(alice.UserID, alice.GuildID, now.Add(-24*time.Hour), 1000)
+	if err := l.Allow(cfg, alice); err != nil {
+		t.Fatalf("limited under the quota: %v", err)
+	}
+	l.Record(alice.UserID, alice.GuildID, *now, 40)
+	bob := access.Subject{UserID: "bob", GuildID: "guild"}
+	if limit := limitError(t, l.Allow(cfg, bob)); limit.Reason != "This server reached its daily token limit (100)" {
+		t.Errorf("reason %q", limit.Reason)
+	}
+}
+
+func TestQuotasStartFromTheLog(t *testing.T) {
+	l, st, now := newLimiter(t)
+	for _, r := range []*storage.RequestLog{
+		{ID: "1", UserID: "alice", GuildID: "guild", Started: now.Add(-time.Hour), InputTokens: 10, OutputTokens: 20},
+		{ID: "2", UserID: "alice", GuildID: "guild", Started: now.Add(-time.Minute)},
+		{ID: "3", UserID: "alice", GuildID: "guild", Started: now.Add(-13 * time.Hour)},
+	} {
+		if err := st.LogRequest(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := config.Limits{Default: config.Limit{DailyRequests: 3}}
+	if err := l.Allow(cfg, alice); err != nil {
+		t.Fatalf("limited with two requests today: %v", err)
+	}
+	limitError(t, l.Allow(cfg, alice))
+}
+
+func TestRolesMostGenerous(t *testing.T) {
+	tests := []struct {
+		name  string
+		roles []string
+		want  config.Limit
+	}{
+		{
+			name: "no roles use the guild",
+			want: config.Limit{DailyRequests: 20},
+		},
+		{
+			name:  "role wins over the guild",
+			roles: []string{"slow"},
+			want:  config.Limit{Rate: 1, Period: time.Minute, DailyRequests: 5},
+		},
+		{
+			name:  "higher allowance of every field",
+			roles: []string{"slow", "fast"},
+			want:  config.Limit{Rate: 10, Period: time.Minute, DailyRequests: 5, DailyTokens: 0},
+		},
+		{
+			name:  "zero is unlimited",
+			roles: []string{"fast", "unlimited"},
+			want:  config.Limit{},
+		},
+	}
+	cfg := config.Limits{
+		Default: config.Limit{DailyRequests: 10},
+		Guilds:  map[string]config.Limit{"guild": {DailyRequests: 20}},
+		Roles: map[string]config.Limit{
+			"slow":      {Rate: 1, Period: time.Minute, DailyRequests: 5},
+			"fast":      {Rate: 10, Period: time.Minute, DailyRequests: 1, DailyTokens: 100},
+			"unlimited": {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := alice
+			s.Roles = tt.roles
+			if got := effective(cfg, s); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExempt(t *testing.T) {
+	l, _, _ := newLimiter(t)
+	cfg := config.Limits{
+		GuildTotal: config.Limit{DailyRequests: 2},
+		Default:    config.Limit{Rate: 1, Period: time.Hour},
+		Exempt:     config.AccessList{Roles: []string{"admin"}},
+	}
+	admin := alice
+	admin.Roles = []string{"admin"}
+	for range 3 {
+		if err := l.Allow(cfg, admin); err != nil {
+			t.Fatalf("exempt role limited: %v", err)
+		}
+	}
+	// Exempt requests still count towards the guild
+	limitError(t, l.Allow(cfg, access.Subject{UserID: "bob", GuildID: "guild"}))
+}
+
+func TestConcurrentReservations(t *testing.T) {
+	l, _, _ := newLimiter(t)
+	cfg := config.Limits{Default: config.Limit{DailyRequests: 10}}
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if l.Allow(cfg, alice) == nil {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 10 {
+		t.Errorf("allowed %d requests, want 10", allowed)
+	}
+}
@@ -0,0 +1,72 @@
+package settings
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/FlameInTheDark/disai/internal/storage"
+)
+
+// Store keeps per-user and per-guild preferences in the storage.
+type Store struct {
+	// mu serializes read-modify-write cycles of the setters
+	mu sync.Mutex
+	st storage.Store
+}
+
+// New creates a settings store on top of the storage.
+func New(st storage.Store) *Store {
+	return &Store{st: st}
+}
+
+// UserProfile returns the profile picked by the user.
+func (s *Store) UserProfile(userID string) string {
+	return s.get(storage.ScopeUser, userID).Profile
+}
+
+// GuildProfile returns the profile picked for the guild.
+func (s *Store) GuildProfile(guildID string) string {
+	return s.get(storage.ScopeGuild, guildID).Profile
+}
+
+// SetUserProfile stores the profile of the user, an empty name removes the choice.
+func (s *Store) SetUserProfile(userID, profile string) error {
+	return s.update(storage.ScopeUser, userID, func(st *storage.Settings) { st.Profile = profile })
+}
+
+// SetGuildProfile stores the profile of the guild, an empty name removes the choice.
+func (s *Store) SetGuildProfile(guildID, profile string) error {
+	return s.update(storage.ScopeGuild, guildID, func(st *storage.Settings) { st.Profile = profile })
+}
+
+// DevGuild returns the guild the commands of the application were last registered in,
+// empty when they were registered globally.
+func (s *Store) DevGuild(appID string) string {
+	return s.get(storage.ScopeApp, appID).DevGuild
+}
+
+// SetDevGuild stores the guild the commands were registered in.
+func (s *Store) SetDevGuild(appID, guildID string) error {
+	return s.update(storage.ScopeApp, appID, func(st *storage.Settings) { st.DevGuild = guildID })
+}
+
+// get returns the settings of the owner, or empty settings when there are none.
+func (s *Store) get(scope storage.Scope, id string) *storage.Settings {
+	st, err := s.st.Settings(scope, id)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			slog.Error("Unable to load settings", slog.String("scope", string(scope)), slog.String("id", id), slog.String("error", err.Error()))
+		}
+		return &storage.Settings{}
+	}
+	return st
+}
+
+func (s *Store) update(scope storage.Scope, id string, fn func(st *storage.Settings)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.get(scope, id)
+	fn(st)
+	return s.st.SaveSettings(scope, id, st)
+}
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketMeta          = []byte("meta")
+	bucketConversations = []byte("conversations")
+	bucketSettings      = []byte("settings")
+	bucketRequests      = []byte("requests")
+
+	keyVersion = []byte("version")
+)
+
+// migrations upgrade the schema one version at a time, the schema version is
+// the number of applied migrations. Never change a released migration, add a new one.
+var migrations = []func(tx *bolt.Tx) error{
+	// 1: buckets of the initial schema
+	func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketConversations, bucketSettings, bucketRequests} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// boltStore keeps every record as JSON in a bbolt database file.
+type boltStore struct {
+	db *bolt.DB
+}
+
+func openBolt(path string) (*boltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open database %s: %w", path, err)
+	}
+	s := &boltStore{db: db}
+	if err := s.migrate(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("unable to migrate database %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// migrate applies the pending migrations, each in its own transaction.
+func (s *boltStore) migrate() error {
+	for {
+		done, err := s.migrateOnce()
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+func (s *boltStore) migrateOnce() (bool, error) {
+	done := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(bucketMeta)
+		if err != nil {
+			return err
+		}
+		var version uint64
+		if v := meta.Get(keyVersion); v != nil {
+			version = binary.BigEndian.Uint64(v)
+		}
+		switch {
+		case version > uint64(len(migrations)):
+			return fmt.Errorf("schema version %d is newer than this build supports (%d)", version, len(migrations))
+		case version == uint64(len(migrations)):
+			done = true
+			return nil
+		}
+		if err := migrations[version](tx); err != nil {
+			return fmt.Errorf("migration %d: %w", version+1, err)
+		}
+		return meta.Put(keyVersion, binary.BigEndian.AppendUint64(nil, version+1))
+	})
+	return done, err
+}
+
+func (s *boltStore) get(bucket []byte, key string, v any) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucket).Get([]byte(key))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, v)
+	})
+}
+
+func (s *boltStore) put(bucket []byte, key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(key), data)
+	})
+}
+
+func (s *boltStore) Conversation(key string) (*Conversation, error) {
+	var c Conversation
+	if err := s.get(bucketConversations, key, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *boltStore) SaveConversation(key string, c *Conversation) error {
+	return s.put(bucketConversations, key, c)
+}
+
+func (s *boltStore) DeleteConversation(key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketConversations).Delete([]byte(key))
+	})
+}
+
+func settingsKey(scope Scope, id string) string {
+	return string(scope) + ":" + id
+}
+
+func (s *boltStore) Settings(scope Scope, id string) (*Settings, error) {
+	var st Settings
+	if err := s.get(bucketSettings, settingsKey(scope, id), &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func (s *boltStore) SaveSettings(scope Scope, id string, st *Settings) error {
+	return s.put(bucketSettings, settingsKey(scope, id), st)
+}
+
+// requestKey orders requests by their start time.
+func requestKey(started time.Time, id string) []byte {
+	return append(binary.BigEndian.AppendUint64(nil, uint64(started.UnixNano())), id...)
+}
+
+func (s *boltStore) LogRequest(r *RequestLog) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketRequests).Put(requestKey(r.Started, r.ID), data)
+	})
+}
+
+func (s *boltStore) Requests(from, to time.Time, fn func(r *RequestLog) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketRequests).Cursor()
+		end := requestKey(to, "")
+		for k, v := c.Seek(requestKey(from, "")); k != nil && string(k) < string(end); k, v = c.Next() {
+			var r RequestLog
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			if err := fn(&r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) PruneRequests(before time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketRequests)
+		end := requestKey(before, "")
+		// Deleting while iterating skips keys, collect them first
+		var keys [][]byte
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && string(k) < string(end); k, _ = c.Next() {
+			keys = append(keys, slices.Clone(k))
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryStore keeps everything in maps, nothing survives a restart.
+type memoryStore struct {
+	mu            sync.Mutex
+	conversations map[string]Conversation
+	settings      map[string]Settings
+	requests      []RequestLog
+}
+
+// NewMemory creates an empty in-memory store, e.g. for tests.
+func NewMemory() Store {
+	return &memoryStore{
+		conversations: make(map[string]Conversation),
+		settings:      make(map[string]Settings),
+	}
+}
+
+func (s *memoryStore) Conversation(key string) (*Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.conversations[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c.Messages = slices.Clone(c.Messages)
+	return &c, nil
+}
+
+func (s *memoryStore) SaveConversation(key string, c *Conversation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *c
+	stored.Messages = slices.Clone(c.Messages)
+	s.conversations[key] = stored
+	return nil
+}
+
+func (s *memoryStore) DeleteConversation(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conversations, key)
+	return nil
+}
+
+func (s *memoryStore) Settings(scope Scope, id string) (*Settings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.settings[settingsKey(scope, id)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &st, nil
+}
+
+func (s *memoryStore) SaveSettings(scope Scope, id string, st *Settings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings[settingsKey(scope, id)] = *st
+	return nil
+}
+
+func (s *memoryStore) LogRequest(r *RequestLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Keep the log ordered by start time like the database does
+	i := sort.Search(len(s.requests), func(i int) bool { return s.requests[i].Started.After(r.Started) })
+	s.requests = slices.Insert(s.requests, i, *r)
+	return nil
+}
+
+func (s *memoryStore) Requests(from, to time.Time, fn func(r *RequestLog) error) error {
+	s.mu.Lock()
+	requests := slices.Clone(s.requests)
+	s.mu.Unlock()
+	for i := range requests {
+		r := &requests[i]
+		if r.Started.Before(from) || !r.Started.Before(to) {
+			continue
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) PruneRequests(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = slices.DeleteFunc(s.requests, func(r RequestLog) bool { return r.Started.Before(before) })
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
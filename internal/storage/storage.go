@@ -0,0 +1,91 @@
+// Package storage persists the state of the bot: conversation history,
+// per-user and per-guild settings and the log of model requests.
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// ErrNotFound is returned when a record does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Store is implemented by the bbolt database and the in-memory store.
+type Store interface {
+	// Conversation returns the history stored under the key.
+	Conversation(key string) (*Conversation, error)
+	SaveConversation(key string, c *Conversation) error
+	DeleteConversation(key string) error
+
+	// Settings returns the settings of a user or a guild.
+	Settings(scope Scope, id string) (*Settings, error)
+	SaveSettings(scope Scope, id string, s *Settings) error
+
+	// LogRequest appends a model request to the request log.
+	LogRequest(r *RequestLog) error
+	// Requests calls fn for every request started in [from, to), oldest first.
+	Requests(from, to time.Time, fn func(r *RequestLog) error) error
+	// PruneRequests removes requests started before the time.
+	PruneRequests(before time.Time) error
+
+	Close() error
+}
+
+// Scope is the owner type of settings.
+type Scope string
+
+const (
+	ScopeUser  Scope = "user"
+	ScopeGuild Scope = "guild"
+	// ScopeApp holds the state of the bot application itself.
+	ScopeApp Scope = "app"
+)
+
+// Conversation is the message history of a channel or thread.
+type Conversation struct {
+	Messages []*ai.Message `json:"messages"`
+	Updated  time.Time     `json:"updated"`
+}
+
+// Settings are preferences of a user or a guild, or the state of the application.
+type Settings struct {
+	// Profile is the name of the picked model profile.
+	Profile string `json:"profile,omitempty"`
+	// DevGuild is the guild the commands were last registered in, only in the app scope.
+	DevGuild string `json:"devGuild,omitempty"`
+}
+
+// Request statuses
+const (
+	StatusOK        = "ok"
+	StatusError     = "error"
+	StatusCancelled = "cancelled"
+)
+
+// RequestLog describes a single chat request.
+type RequestLog struct {
+	ID        string        `json:"id"`
+	UserID    string        `json:"userId"`
+	GuildID   string        `json:"guildId,omitempty"`
+	ChannelID string        `json:"channelId"`
+	Profile   string        `json:"profile"`
+	Model     string        `json:"model"`
+	Started   time.Time     `json:"started"`
+	Duration  time.Duration `json:"duration"`
+	Status    string        `json:"status"`
+	Error     string        `json:"error,omitempty"`
+	// InputTokens and OutputTokens are summed over all model turns of the request.
+	InputTokens  int `json:"inputTokens,omitempty"`
+	OutputTokens int `json:"outputTokens,omitempty"`
+}
+
+// Open opens the database at the path and runs pending migrations.
+// An empty path gives an in-memory store that is lost on restart.
+func Open(path string) (Store, error) {
+	if path == "" {
+		return NewMemory(), nil
+	}
+	return openBolt(path)
+}
@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	bolt "go.etcd.io/bbolt"
+)
+
+// stores runs the test against the in-memory store and a bbolt store in a temp dir.
+func stores(t *testing.T, test func(t *testing.T, st Store)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemory())
+	})
+	t.Run("bolt", func(t *testing.T) {
+		st, err := Open(filepath.Join(t.TempDir(), "disai.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer st.Close()
+		test(t, st)
+	})
+}
+
+func TestConversation(t *testing.T) {
+	stores(t, func(t *testing.T, st Store) {
+		if _, err := st.Conversation("c"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("got %v, want %v", err, ErrNotFound)
+		}
+		updated := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+		in := &Conversation{
+			Messages: []*ai.Message{
+				ai.NewUserTextMessage("weather?"),
+				ai.NewModelMessage(ai.NewToolRequestPart(&ai.ToolRequest{Name: "weather", Ref: "1", Input: map[string]any{"city": "Tokyo"}})),
+				ai.NewMessage(ai.RoleTool, nil, ai.NewToolResponsePart(&ai.ToolResponse{Name: "weather", Ref: "1", Output: map[string]any{"temp": 21.5}})),
+				ai.NewModelTextMessage("It is sunny."),
+			},
+			Updated: updated,
+		}
+		if err := st.SaveConversation("c", in); err != nil {
+			t.Fatal(err)
+		}
+		out, err := st.Conversation("c")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !out.Updated.Equal(updated) {
+			t.Errorf("updated %v, want %v", out.Updated, updated)
+		}
+		if len(out.Messages) != len(in.Messages) {
+			t.Fatalf("got %d messages, want %d", len(out.Messages), len(in.Messages))
+		}
+		for i, msg := range out.Messages {
+			if msg.Role != in.Messages[i].Role {
+				t.Errorf("message %d has role %s, want %s", i, msg.Role, in.Messages[i].Role)
+			}
+		}
+		req := out.Messages[1].Content[0]
+		if !req.IsToolRequest() || req.ToolRequest.Name != "weather" || req.ToolRequest.Input.(map[string]any)["city"] != "Tokyo" {
+			t.Errorf("tool request did not survive: %+v", req)
+		}
+		resp := out.Messages[2].Content[0]
+		if !resp.IsToolResponse() || resp.ToolResponse.Output.(map[string]any)["temp"] != 21.5 {
+			t.Errorf("tool response did not survive: %+v", resp)
+		}
+		if text := out.Messages[3].Text(); text != "It is sunny." {
+			t.Errorf("got text %q", text)
+		}
+
+		if err := st.DeleteConversation("c"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := st.Conversation("c"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("got %v after delete, want %v", err, ErrNotFound)
+		}
+	})
+}
+
+func TestSettings(t *testing.T) {
+	stores(t, func(t *testing.T, st Store) {
+		if _, err := st.Settings(ScopeUser, "1"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("got %v, want %v", err, ErrNotFound)
+		}
+		if err := st.SaveSettings(ScopeUser, "1", &Settings{Profile: "coder"}); err != nil {
+			t.Fatal(err)
+		}
+		// The same ID in another scope is a different record
+		if _, err := st.Settings(ScopeGuild, "1"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("guild settings: got %v, want %v", err, ErrNotFound)
+		}
+		s, err := st.Settings(ScopeUser, "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Profile != "coder" {
+			t.Errorf("profile %q, want coder", s.Profile)
+		}
+		if err := st.SaveSettings(ScopeApp, "1", &Settings{DevGuild: "2"}); err != nil {
+			t.Fatal(err)
+		}
+		if s, err := st.Settings(ScopeApp, "1"); err != nil || s.DevGuild != "2" {
+			t.Errorf("app settings: got %+v, %v", s, err)
+		}
+	})
+}
+
+func TestRequests(t *testing.T) {
+	stores(t, func(t *testing.T, st Store) {
+		base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		// Logged out of order, read oldest first
+		for _, i := range []int{2, 0, 3, 1} {
+			r := &RequestLog{ID: string(rune('a' + i)), UserID: "u", Started: base.Add(time.Duration(i) * time.Hour), InputTokens: i}
+			if err := st.LogRequest(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ids := func(from, to time.Time) string {
+			var out []string
+			err := st.Requests(from, to, func(r *RequestLog) error {
+				out = append(out, r.ID)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return strings.Join(out, "")
+		}
+		tests := []struct {
+			name     string
+			from, to time.Time
+			want     string
+		}{
+			{"everything", base, base.Add(24 * time.Hour), "abcd"},
+			{"from is inclusive", base.Add(time.Hour), base.Add(24 * time.Hour), "bcd"},
+			{"to is exclusive", base, base.Add(2 * time.Hour), "ab"},
+			{"empty range", base.Add(time.Hour), base.Add(time.Hour), ""},
+			{"before all", base.Add(-time.Hour), base, ""},
+		}
+		for _, tt := range tests {
+			if got := ids(tt.from, tt.to); got != tt.want {
+				t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+			}
+		}
+
+		stop := errors.New("stop")
+		err := st.Requests(base, base.Add(24*time.Hour), func(r *RequestLog) error { return stop })
+		if !errors.Is(err, stop) {
+			t.Errorf("got %v, want the error of the callback", err)
+		}
+
+		if err := st.PruneRequests(base.Add(2 * time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(base, base.Add(24*time.Hour)); got != "cd" {
+			t.Errorf("after pruning got %q, want cd", got)
+		}
+	})
+}
+
+func TestMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disai.db")
+	st, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SaveSettings(ScopeUser, "1", &Settings{Profile: "coder"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopening keeps the data and does not migrate again
+	st, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := st.Settings(ScopeUser, "1"); err != nil || s.Profile != "coder" {
+		t.Fatalf("settings after reopening: %v, %v", s, err)
+	}
+	if v := schemaVersion(t, st.(*boltStore).db); v != uint64(len(migrations)) {
+		t.Errorf("schema version %d, want %d", v, len(migrations))
+	}
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A database of a newer build is refused
+	db, err := bolt.Open(path, 0o600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketMeta).Put(keyVersion, binary.BigEndian.AppendUint64(nil, uint64(len(migrations)+1)))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = db.Close()
+	if _, err := Open(path); err == nil {
+		t.Fatal("opened a database with a newer schema")
+	}
+}
+
+func schemaVersion(t *testing.T, db *bolt.DB) uint64 {
+	t.Helper()
+	var v uint64
+	err := db.View(func(tx *bolt.Tx) error {
+		v = binary.BigEndian.Uint64(tx.Bucket(bucketMeta).Get(keyVersion))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
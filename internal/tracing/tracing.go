@@ -0,0 +1,114 @@
+// Package tracing exports OpenTelemetry traces of the bot, the model turns and
+// the tool calls to an OTLP endpoint or a file.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/FlameInTheDark/disai/internal/config"
+)
+
+// Exporters of the tracing config.
+const (
+	ExporterOTLP = "otlp"
+	ExporterFile = "file"
+)
+
+const tracerName = "github.com/FlameInTheDark/disai"
+
+// Setup installs the global tracer provider, Genkit uses it for its own spans too.
+// The returned function flushes and stops the exporter. Nothing is exported when
+// no exporter is configured.
+func Setup(ctx context.Context, cfg config.Tracing) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		// Without an endpoint the OTEL_EXPORTER_OTLP_* variables apply
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		}
+		exp, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create the OTLP exporter: %w", err)
+		}
+		exporter = exp
+	case ExporterFile:
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open the trace file: %w", err)
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("unable to create the file exporter: %w", err)
+		}
+		exporter = closingExporter{SpanExporter: exp, f: f}
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(attribute.String("service.name", cfg.ServiceName)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to describe the service: %w", err)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp.Shutdown, nil
+}
+
+// closingExporter closes the trace file after the last spans are written.
+type closingExporter struct {
+	sdktrace.SpanExporter
+	f *os.File
+}
+
+func (e closingExporter) Shutdown(ctx context.Context) error {
+	err := e.SpanExporter.Shutdown(ctx)
+	if cerr := e.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Start starts a span of the bot.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// Fail records the error on the span, nil errors are ignored.
+func Fail(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// End records the error on the span, if any, and ends it.
+func End(span trace.Span, err error) {
+	Fail(span, err)
+	span.End()
+}